@@ -3,9 +3,13 @@ module github.com/lftk/anki-vocab
 go 1.24
 
 require (
+	github.com/hajimehoshi/go-mp3 v0.3.4
 	github.com/lftk/anki v0.0.0-20250917162758-53667766541c
+	github.com/mattn/go-sqlite3 v1.14.28
 	github.com/urfave/cli/v3 v3.4.1
 	github.com/volcengine/volcengine-go-sdk v1.1.30
+	golang.org/x/sync v0.16.0
+	golang.org/x/text v0.28.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -14,7 +18,6 @@ require (
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
 	github.com/klauspost/compress v1.18.0 // indirect
-	github.com/mattn/go-sqlite3 v1.14.28 // indirect
 	github.com/volcengine/volc-sdk-golang v1.0.23 // indirect
 	google.golang.org/protobuf v1.36.6 // indirect
 	gopkg.in/yaml.v2 v2.2.8 // indirect
@@ -0,0 +1,234 @@
+// Package audio post-processes pronunciations: it trims silence, normalizes
+// loudness and converts between formats. MP3 and WAV decoding and WAV
+// encoding are done in pure Go; any other format requires ffmpeg.
+package audio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+)
+
+// Config configures the processing of the audio files of a notetype.
+type Config struct {
+	// TrimSilence removes the silence at the start and the end.
+	TrimSilence bool `yaml:"trim_silence"`
+
+	// SilenceThreshold is the level in dBFS below which audio is considered
+	// silent, -50 by default.
+	SilenceThreshold float64 `yaml:"silence_threshold"`
+
+	// Normalize is the target loudness as RMS level in dBFS, e.g. -20.
+	// Zero leaves the loudness unchanged.
+	Normalize float64 `yaml:"normalize"`
+
+	// Format is the format of the processed audio, e.g. "wav" or "mp3".
+	// If empty, the format of the source is kept.
+	Format string `yaml:"format"`
+}
+
+func (c *Config) Validate() error {
+	if c.SilenceThreshold > 0 {
+		return fmt.Errorf("silence_threshold must not be positive, got %g", c.SilenceThreshold)
+	}
+	if c.Normalize > 0 {
+		return fmt.Errorf("normalize must not be positive, got %g", c.Normalize)
+	}
+	return nil
+}
+
+// Enabled reports whether audio in the given format needs processing.
+func (c *Config) Enabled(format string) bool {
+	if c == nil {
+		return false
+	}
+	return c.TrimSilence || c.Normalize != 0 || (c.Format != "" && c.Format != format)
+}
+
+// OutputFormat returns the format of audio in the given format once processed.
+func (c *Config) OutputFormat(format string) string {
+	if c == nil || c.Format == "" {
+		return format
+	}
+	return c.Format
+}
+
+const (
+	defaultSilenceThreshold = -50
+
+	// silencePadding is the silence kept around the sound when trimming,
+	// in seconds, so that it does not start abruptly.
+	silencePadding = 0.05
+
+	// peakCeiling is the maximum peak level in dBFS after normalization.
+	peakCeiling = -1
+)
+
+// Process processes data in the given format according to cfg, returning
+// the processed data and its format. Audio in formats other than MP3 and
+// WAV, such as ogg, is decoded with ffmpeg, or returned unchanged if ffmpeg
+// is not installed. Canceling ctx stops the conversion.
+func Process(ctx context.Context, data []byte, format string, cfg *Config) ([]byte, string, error) {
+	if !cfg.Enabled(format) {
+		return data, format, nil
+	}
+
+	p, err := decode(ctx, data, format)
+	if errors.Is(err, errNoDecoder) {
+		return data, format, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	if cfg.TrimSilence {
+		threshold := cfg.SilenceThreshold
+		if threshold == 0 {
+			threshold = defaultSilenceThreshold
+		}
+		p.trim(threshold)
+	}
+	if cfg.Normalize != 0 {
+		p.normalize(cfg.Normalize)
+	}
+
+	format = cfg.OutputFormat(format)
+	data, err = encode(ctx, p, format)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, format, nil
+}
+
+// pcm is 16-bit linear PCM audio with interleaved channels.
+type pcm struct {
+	rate     int
+	channels int
+	samples  []int16
+}
+
+func (p *pcm) frames() int {
+	return len(p.samples) / p.channels
+}
+
+// trim removes the frames quieter than threshold dBFS at both ends.
+func (p *pcm) trim(threshold float64) {
+	level := level(threshold)
+	loud := func(frame int) bool {
+		for _, s := range p.samples[frame*p.channels : (frame+1)*p.channels] {
+			if math.Abs(float64(s)) > level {
+				return true
+			}
+		}
+		return false
+	}
+
+	n := p.frames()
+	start := 0
+	for start < n && !loud(start) {
+		start++
+	}
+	if start == n {
+		// All silent, keep it as is rather than producing nothing.
+		return
+	}
+	end := n
+	for end > start && !loud(end-1) {
+		end--
+	}
+
+	pad := int(silencePadding * float64(p.rate))
+	start = max(start-pad, 0)
+	end = min(end+pad, n)
+	p.samples = p.samples[start*p.channels : end*p.channels]
+}
+
+// normalize scales the audio to an RMS level of target dBFS, reducing the
+// gain if needed to keep the peaks below peakCeiling.
+func (p *pcm) normalize(target float64) {
+	var sum, peak float64
+	for _, s := range p.samples {
+		v := float64(s)
+		sum += v * v
+		peak = max(peak, math.Abs(v))
+	}
+	if peak == 0 {
+		return
+	}
+	rms := math.Sqrt(sum / float64(len(p.samples)))
+
+	gain := min(level(target)/rms, level(peakCeiling)/peak)
+	for i, s := range p.samples {
+		v := math.Round(float64(s) * gain)
+		p.samples[i] = int16(max(min(v, math.MaxInt16), math.MinInt16))
+	}
+}
+
+// level converts a level in dBFS to a sample amplitude.
+func level(dBFS float64) float64 {
+	return math.Pow(10, dBFS/20) * math.MaxInt16
+}
+
+// errNoDecoder is returned by decode for formats that need ffmpeg when it
+// is not installed.
+var errNoDecoder = errors.New("no audio decoder")
+
+func decode(ctx context.Context, data []byte, format string) (*pcm, error) {
+	switch format {
+	case "mp3":
+		return decodeMP3(data)
+	case "wav":
+		return decodeWAV(data)
+	}
+
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return nil, errNoDecoder
+	}
+	wav, err := ffmpeg(ctx, data, "wav")
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s audio: %w", format, err)
+	}
+	return decodeWAV(wav)
+}
+
+func encode(ctx context.Context, p *pcm, format string) ([]byte, error) {
+	wav := encodeWAV(p)
+	if format == "wav" {
+		return wav, nil
+	}
+	return ffmpeg(ctx, wav, format)
+}
+
+// ffmpeg converts audio, whose format ffmpeg detects, to the given format.
+// WAV output holds 16-bit PCM audio, as decodeWAV expects.
+func ffmpeg(ctx context.Context, data []byte, format string) ([]byte, error) {
+	path, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return nil, fmt.Errorf("encoding %s audio requires ffmpeg: %w", format, err)
+	}
+
+	args := []string{"-hide_banner", "-loglevel", "error", "-i", "pipe:0"}
+	if format == "wav" {
+		args = append(args, "-c:a", "pcm_s16le")
+	}
+	args = append(args, "-f", format, "pipe:1")
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err = cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if msg := bytes.TrimSpace(stderr.Bytes()); len(msg) > 0 {
+			err = errors.New(string(msg))
+		}
+		return nil, fmt.Errorf("ffmpeg: %w", err)
+	}
+	return stdout.Bytes(), nil
+}
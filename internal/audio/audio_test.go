@@ -0,0 +1,160 @@
+package audio
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+// tone returns mono audio of silence, a sine wave and silence again, each
+// lasting the given number of frames.
+func tone(rate, silence, sound int) *pcm {
+	p := &pcm{rate: rate, channels: 1}
+	p.samples = make([]int16, silence)
+	for i := range sound {
+		v := 8000 * math.Sin(2*math.Pi*440*float64(i)/float64(rate))
+		p.samples = append(p.samples, int16(v))
+	}
+	p.samples = append(p.samples, make([]int16, silence)...)
+	return p
+}
+
+func TestWAVRoundTrip(t *testing.T) {
+	p := tone(8000, 100, 400)
+	p.channels = 2 // Interleaved frames of two samples.
+
+	got, err := decodeWAV(encodeWAV(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.rate != p.rate || got.channels != p.channels {
+		t.Errorf("decoded %d Hz, %d channels, want %d Hz, %d channels", got.rate, got.channels, p.rate, p.channels)
+	}
+	if !slices.Equal(got.samples, p.samples) {
+		t.Error("decoded samples differ from the encoded ones")
+	}
+}
+
+func TestDecodeWAVInvalid(t *testing.T) {
+	for _, data := range [][]byte{nil, []byte("RIFF\x00\x00\x00\x00WAVE"), []byte("ID3 not a wav file")} {
+		if _, err := decodeWAV(data); err == nil {
+			t.Errorf("decodeWAV(%q) succeeded", data)
+		}
+	}
+}
+
+func TestProcessTrimSilence(t *testing.T) {
+	const (
+		rate    = 8000
+		silence = 4000
+		sound   = 2000
+	)
+	data := encodeWAV(tone(rate, silence, sound))
+
+	out, format, err := Process(context.Background(), data, "wav", &Config{TrimSilence: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "wav" {
+		t.Errorf("format = %q, want wav", format)
+	}
+	p, err := decodeWAV(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The sound is kept with silencePadding on both sides, give or take
+	// the quiet samples at the zero crossings of the wave.
+	want := sound + 2*int(silencePadding*rate)
+	if n := p.frames(); n < want-10 || n > want {
+		t.Errorf("trimmed to %d frames, want about %d", n, want)
+	}
+}
+
+func TestProcessNormalize(t *testing.T) {
+	data := encodeWAV(tone(8000, 0, 8000))
+	out, _, err := Process(context.Background(), data, "wav", &Config{Normalize: -20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := decodeWAV(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sum float64
+	for _, s := range p.samples {
+		sum += float64(s) * float64(s)
+	}
+	rms := 20 * math.Log10(math.Sqrt(sum/float64(len(p.samples)))/math.MaxInt16)
+	if math.Abs(rms+20) > 0.1 {
+		t.Errorf("normalized to %.2f dBFS, want -20", rms)
+	}
+}
+
+func TestProcessDisabled(t *testing.T) {
+	data := []byte("not even audio")
+	out, format, err := Process(context.Background(), data, "mp3", &Config{Format: "mp3"})
+	if err != nil || format != "mp3" || string(out) != string(data) {
+		t.Errorf("Process() = %q, %q, %v, want the data unchanged", out, format, err)
+	}
+}
+
+func TestProcessCanceled(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg is not installed")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := Process(ctx, encodeWAV(tone(8000, 0, 800)), "wav", &Config{Format: "mp3"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Process() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestProcessWithoutDecoder(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	data := []byte("OggS not really")
+	out, format, err := Process(context.Background(), data, "ogg", &Config{TrimSilence: true, Format: "wav"})
+	if err != nil || format != "ogg" || string(out) != string(data) {
+		t.Errorf("Process() = %q, %q, %v, want the data unchanged", out, format, err)
+	}
+}
+
+func TestProcessFFmpegDecode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ffmpeg is a shell script")
+	}
+	dir := t.TempDir()
+	wav := filepath.Join(dir, "out.wav")
+	if err := os.WriteFile(wav, encodeWAV(tone(8000, 4000, 2000)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// The fake ffmpeg ignores its input and always outputs the same WAV.
+	script := "#!/bin/sh\ncat >/dev/null\ncat " + wav + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "ffmpeg"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	out, format, err := Process(context.Background(), []byte("OggS"), "ogg", &Config{TrimSilence: true, Format: "wav"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "wav" {
+		t.Errorf("format = %q, want wav", format)
+	}
+	p, err := decodeWAV(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := p.frames(); n >= 4000 {
+		t.Errorf("got %d frames, want the silence trimmed", n)
+	}
+}
@@ -0,0 +1,103 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/hajimehoshi/go-mp3"
+)
+
+func decodeMP3(data []byte) (*pcm, error) {
+	d, err := mp3.NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(d)
+	if err != nil {
+		return nil, err
+	}
+
+	// The decoder always yields 16-bit little-endian stereo.
+	samples := make([]int16, len(b)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(b[2*i:]))
+	}
+	return &pcm{rate: d.SampleRate(), channels: 2, samples: samples}, nil
+}
+
+// decodeWAV decodes a WAV file holding 16-bit PCM audio.
+func decodeWAV(data []byte) (*pcm, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, errors.New("not a WAV file")
+	}
+
+	var (
+		p      pcm
+		hasFmt bool
+	)
+	for b := data[12:]; len(b) >= 8; {
+		id, size := string(b[:4]), int(binary.LittleEndian.Uint32(b[4:8]))
+		b = b[8:]
+		if size > len(b) {
+			size = len(b)
+		}
+		chunk := b[:size]
+
+		switch id {
+		case "fmt ":
+			if len(chunk) < 16 {
+				return nil, errors.New("invalid WAV format chunk")
+			}
+			tag := binary.LittleEndian.Uint16(chunk[0:])
+			bits := binary.LittleEndian.Uint16(chunk[14:])
+			if tag != 1 || bits != 16 {
+				return nil, fmt.Errorf("unsupported WAV encoding %d with %d bits per sample", tag, bits)
+			}
+			p.channels = int(binary.LittleEndian.Uint16(chunk[2:]))
+			p.rate = int(binary.LittleEndian.Uint32(chunk[4:]))
+			hasFmt = true
+
+		case "data":
+			if !hasFmt || p.channels == 0 {
+				return nil, errors.New("WAV data before format chunk")
+			}
+			p.samples = make([]int16, len(chunk)/2)
+			for i := range p.samples {
+				p.samples[i] = int16(binary.LittleEndian.Uint16(chunk[2*i:]))
+			}
+			p.samples = p.samples[:p.frames()*p.channels]
+			return &p, nil
+		}
+
+		// Chunks are padded to an even size.
+		b = b[min(size+size%2, len(b)):]
+	}
+	return nil, errors.New("no data in WAV file")
+}
+
+func encodeWAV(p *pcm) []byte {
+	size := 2 * len(p.samples)
+	b := make([]byte, 0, 44+size)
+	b = append(b, "RIFF"...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(36+size))
+	b = append(b, "WAVE"...)
+
+	b = append(b, "fmt "...)
+	b = binary.LittleEndian.AppendUint32(b, 16)
+	b = binary.LittleEndian.AppendUint16(b, 1) // PCM
+	b = binary.LittleEndian.AppendUint16(b, uint16(p.channels))
+	b = binary.LittleEndian.AppendUint32(b, uint32(p.rate))
+	b = binary.LittleEndian.AppendUint32(b, uint32(p.rate*p.channels*2))
+	b = binary.LittleEndian.AppendUint16(b, uint16(p.channels*2))
+	b = binary.LittleEndian.AppendUint16(b, 16)
+
+	b = append(b, "data"...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(size))
+	for _, s := range p.samples {
+		b = binary.LittleEndian.AppendUint16(b, uint16(s))
+	}
+	return b
+}
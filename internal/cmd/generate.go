@@ -2,18 +2,24 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/lftk/anki"
 	"github.com/urfave/cli/v3"
 
+	"github.com/lftk/anki-vocab/internal/dict"
 	"github.com/lftk/anki-vocab/internal/generate"
 	"github.com/lftk/anki-vocab/internal/notetype"
 	"github.com/lftk/anki-vocab/internal/registry"
+	"github.com/lftk/anki-vocab/internal/set"
 	"github.com/lftk/anki-vocab/internal/wordlist"
 )
 
@@ -29,8 +35,8 @@ func newGenerateCmd(defaultNotetype fs.FS) *cli.Command {
 
 	return &cli.Command{
 		Name:      "generate",
-		Usage:     "Generate Anki package from a wordlist file",
-		ArgsUsage: "<wordlist_file>",
+		Usage:     "Generate Anki package from wordlist files or existing Anki packages",
+		ArgsUsage: "<wordlist_file>...",
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:     "name",
@@ -61,6 +67,32 @@ func newGenerateCmd(defaultNotetype fs.FS) *cli.Command {
 				Name:  "no-cache",
 				Usage: "Disable caching.",
 			},
+			&cli.StringFlag{
+				Name:  "record",
+				Usage: "Record the results of the dictionaries into this directory, for --replay.",
+			},
+			&cli.StringFlag{
+				Name:  "replay",
+				Usage: "Replay the results recorded into this directory instead of querying the dictionaries.",
+			},
+			&cli.StringFlag{
+				Name:  "field",
+				Usage: "The note field used as the word when reading an Anki package (.apkg, .colpkg). Defaults to the first field.",
+			},
+			&cli.StringFlag{
+				Name:  "case",
+				Value: string(wordlist.CasePreserve),
+				Usage: "How to treat letter case of words: preserve, lower or fold (compare case-insensitively).",
+			},
+			&cli.StringFlag{
+				Name:  "duplicates",
+				Value: string(wordlist.DuplicateFirst),
+				Usage: "How to handle duplicate words: first (keep the first), merge (keep the first, merging tags) or decks (allow once per deck).",
+			},
+			&cli.IntFlag{
+				Name:  "max-tokens-budget",
+				Usage: "Stop querying AI dictionaries for new words once this many tokens are used. 0 means no limit.",
+			},
 			&cli.BoolFlag{
 				Name:    "verbose",
 				Aliases: []string{"v"},
@@ -68,10 +100,13 @@ func newGenerateCmd(defaultNotetype fs.FS) *cli.Command {
 			},
 		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
-			wordlistPath := cmd.Args().First()
-			if wordlistPath == "" {
+			if cmd.Args().Len() == 0 {
 				return fmt.Errorf("missing required argument: wordlist_file")
 			}
+			wordlistPaths, err := wordlist.Glob(cmd.Args().Slice()...)
+			if err != nil {
+				return err
+			}
 
 			name := cmd.String("name")
 			notetypeDir := cmd.String("notetype")
@@ -88,18 +123,42 @@ func newGenerateCmd(defaultNotetype fs.FS) *cli.Command {
 				cacheDir = ""
 			}
 
-			return runGenerate(ctx, defaultNotetype, name, output, dictsPath, notetypeDir, wordlistPath, cacheDir, verbose)
+			fixtures := &fixtures{record: cmd.String("record"), replay: cmd.String("replay")}
+			if fixtures.record != "" && fixtures.replay != "" {
+				return errors.New("--record and --replay cannot be used together")
+			}
+
+			caseMode, err := wordlist.ParseCaseMode(cmd.String("case"))
+			if err != nil {
+				return err
+			}
+			dupMode, err := wordlist.ParseDuplicateMode(cmd.String("duplicates"))
+			if err != nil {
+				return err
+			}
+			opts := &wordlist.Options{
+				Case:       caseMode,
+				Duplicates: dupMode,
+				Field:      cmd.String("field"),
+			}
+
+			budget := cmd.Int("max-tokens-budget")
+			if budget < 0 {
+				return fmt.Errorf("invalid --max-tokens-budget %d", budget)
+			}
+
+			return runGenerate(ctx, defaultNotetype, name, output, dictsPath, notetypeDir, wordlistPaths, opts, cacheDir, fixtures, budget, verbose)
 		},
 	}
 }
 
-func runGenerate(ctx context.Context, defaultNotetype fs.FS, name, apkgPath, dictsPath, notetypeDir, wordlistPath, cacheDir string, verbose bool) error {
+func runGenerate(ctx context.Context, defaultNotetype fs.FS, name, apkgPath, dictsPath, notetypeDir string, wordlistPaths []string, opts *wordlist.Options, cacheDir string, fixtures *fixtures, budget int, verbose bool) error {
 	nt, err := loadNotetype(defaultNotetype, notetypeDir)
 	if err != nil {
 		return err
 	}
 
-	g, err := newGenerator(nt.Fields(), dictsPath, cacheDir)
+	g, err := newGenerator(nt, dictsPath, cacheDir, fixtures)
 	if err != nil {
 		return err
 	}
@@ -115,54 +174,114 @@ func runGenerate(ctx context.Context, defaultNotetype fs.FS, name, apkgPath, dic
 		return err
 	}
 
-	fmt.Printf("Generating deck '%s' from '%s'...\n", name, wordlistPath)
+	fmt.Printf("Generating deck '%s' from '%s'...\n", name, strings.Join(wordlistPaths, "', '"))
 
-	var count int
-	for deck, err := range wordlist.Load(wordlistPath) {
-		if err != nil {
-			return err
-		}
+	decks, dups, err := wordlist.Normalize(wordlist.LoadAll(wordlistPaths, opts), opts)
+	if err != nil {
+		return err
+	}
+	printDuplicates(dups)
 
-		deckName := []string{name}
-		if deck.Name != "" {
-			deckName = append(deckName, deck.Name)
-		}
-		did, err := addAnkiDeck(col, deckName...)
+	stats := dict.NewStats(budget)
+	ctx = dict.WithStats(ctx, stats)
+
+	var words []*wordlist.Word
+	for _, deck := range decks {
+		words = append(words, deck.Words...)
+	}
+	if err = g.Prepare(ctx, words); err != nil && !errors.Is(err, dict.ErrBudgetExceeded) {
+		return fmt.Errorf("failed to query words in batches: %w", err)
+	}
+
+	var count, skipped int
+	dids := make(map[anki.DeckName]int64)
+	media := set.Make[string]()
+	for _, deck := range decks {
+		deckName := append([]string{name}, deck.Path...)
+		did, err := loadOrAddAnkiDeck(col, dids, deckName...)
 		if err != nil {
 			return err
 		}
 
-		dw := &deckWriter{
-			col:  col,
-			did:  did,
-			ntid: ntid,
-		}
 		for _, word := range deck.Words {
 			if count++; verbose {
 				fmt.Printf("[%04d] Processing: %s\n", count, word.Text)
 			}
-			err = g.Generate(ctx, dw, word.Text)
+			dw := &deckWriter{
+				col:   col,
+				did:   did,
+				ntid:  ntid,
+				tags:  ankiTags(word.Tags),
+				media: media,
+			}
+			err = g.Generate(ctx, dw, deck, word)
+			if errors.Is(err, dict.ErrBudgetExceeded) {
+				// Words that need no more tokens, e.g. cached ones, can
+				// still be generated.
+				skipped++
+				continue
+			}
 			if err != nil {
 				return fmt.Errorf("failed to generate for word %q: %w", word.Text, err)
 			}
 		}
 	}
 
-	fmt.Printf("Successfully generated %d words. Saving to %s...\n", count, apkgPath)
+	printStats(stats)
+	if skipped > 0 {
+		fmt.Printf("Warning: token budget of %d reached, skipped %d words.\n", budget, skipped)
+	}
+	fmt.Printf("Successfully generated %d words. Saving to %s...\n", count-skipped, apkgPath)
 
 	return col.SaveAs(apkgPath)
 }
 
+func printDuplicates(dups []*wordlist.Duplicate) {
+	if len(dups) == 0 {
+		return
+	}
+
+	var total int
+	words := make([]string, 0, len(dups))
+	for _, dup := range dups {
+		total += dup.Count
+		words = append(words, fmt.Sprintf("%s (%d)", dup.Word, dup.Count))
+	}
+	fmt.Printf("Warning: removed %d duplicate occurrences of %d words: %s\n", total, len(dups), strings.Join(words, ", "))
+}
+
+func printStats(stats *dict.Stats) {
+	if usage := stats.Usage(); len(usage) > 0 {
+		for _, name := range slices.Sorted(maps.Keys(usage)) {
+			u := usage[name]
+			fmt.Printf("Token usage of %s: %d prompt + %d completion = %d tokens\n", name, u.PromptTokens, u.CompletionTokens, u.TotalTokens())
+		}
+		if len(usage) > 1 {
+			fmt.Printf("Total token usage: %d tokens\n", stats.TotalUsage().TotalTokens())
+		}
+	}
+	if repaired := stats.Repaired(); len(repaired) > 0 {
+		fmt.Printf("Warning: repaired invalid AI responses for %d words: %s\n", len(repaired), strings.Join(repaired, ", "))
+	}
+}
+
 type deckWriter struct {
 	col  *anki.Collection
 	did  int64
 	ntid int64
+	tags []string
+
+	// media holds the names of the media files in the collection. The
+	// generator gives the same data the same name, so a file with a known
+	// name is never written again.
+	media *set.Set[string]
 }
 
 func (dw *deckWriter) Write(fields []string, media map[string]io.Reader) error {
 	n := &anki.Note{
 		Fields:     fields,
 		NotetypeID: dw.ntid,
+		Tags:       dw.tags,
 	}
 	err := dw.col.AddNote(dw.did, n)
 	if err != nil {
@@ -170,6 +289,11 @@ func (dw *deckWriter) Write(fields []string, media map[string]io.Reader) error {
 	}
 
 	for name, r := range media {
+		if dw.media.Contains(name) {
+			continue
+		}
+		dw.media.Add(name)
+
 		w, err := dw.col.CreateMedia(name)
 		if err != nil {
 			return err
@@ -185,12 +309,34 @@ func (dw *deckWriter) Write(fields []string, media map[string]io.Reader) error {
 	return nil
 }
 
-func newGenerator(fields []*notetype.Field, dictsPath, cacheDir string) (*generate.Generator, error) {
+// ankiTags converts wordlist tags to Anki tags, which cannot contain spaces.
+func ankiTags(tags []string) []string {
+	ts := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		ts = append(ts, strings.Join(strings.Fields(tag), "_"))
+	}
+	return ts
+}
+
+// fixtures are the directories to record the results of the dictionaries
+// into or to replay them from, if any.
+type fixtures struct {
+	record string
+	replay string
+}
+
+func newGenerator(nt *notetype.Notetype, dictsPath, cacheDir string, fixtures *fixtures) (*generate.Generator, error) {
 	r, err := registry.New(dictsPath, cacheDir)
 	if err != nil {
 		return nil, err
 	}
-	return generate.New(r, fields)
+	switch {
+	case fixtures.record != "":
+		r.Record(fixtures.record)
+	case fixtures.replay != "":
+		r.Replay(fixtures.replay)
+	}
+	return generate.New(r, nt)
 }
 
 func loadNotetype(defaultNotetype fs.FS, dir string) (*notetype.Notetype, error) {
@@ -212,9 +358,21 @@ func addAnkiNotetype(col *anki.Collection, nt *notetype.Notetype) (int64, error)
 	return ant.ID, nil
 }
 
-func addAnkiDeck(col *anki.Collection, name ...string) (int64, error) {
+func loadOrAddAnkiDeck(col *anki.Collection, decks map[anki.DeckName]int64, name ...string) (int64, error) {
+	deckName := anki.JoinDeckName(name...)
+	if did, ok := decks[deckName]; ok {
+		return did, nil
+	}
+	did, err := addAnkiDeck(col, deckName)
+	if err == nil {
+		decks[deckName] = did
+	}
+	return did, err
+}
+
+func addAnkiDeck(col *anki.Collection, name anki.DeckName) (int64, error) {
 	d := &anki.Deck{
-		Name: anki.JoinDeckName(name...),
+		Name: name,
 	}
 	err := col.AddDeck(d)
 	if err != nil {
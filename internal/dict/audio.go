@@ -0,0 +1,45 @@
+package dict
+
+import (
+	"iter"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// DefaultAccent is the accent of the pronunciations of dictionaries that do
+// not tell accents apart, such as most dictionary files.
+const DefaultAccent = "us"
+
+var audioExts = map[string]bool{"mp3": true, "wav": true, "ogg": true, "spx": true}
+
+// AudioFormat returns the most common format of the audio files among
+// names, or "" if there are none.
+func AudioFormat(names iter.Seq[string]) string {
+	counts := make(map[string]int)
+	var best string
+	for name := range names {
+		ext := strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+		if !audioExts[ext] {
+			continue
+		}
+		counts[ext]++
+		if counts[ext] > counts[best] {
+			best = ext
+		}
+	}
+	return best
+}
+
+// soundLink matches the links to audio files in HTML definitions.
+var soundLink = regexp.MustCompile(`sound://([^"'\s<>]+)`)
+
+// SoundLinks returns the names of the audio files that an HTML definition
+// of a StarDict or MDict dictionary links to, as in "sound://run.mp3".
+func SoundLinks(html string) []string {
+	var links []string
+	for _, m := range soundLink.FindAllStringSubmatch(html, -1) {
+		links = append(links, m[1])
+	}
+	return links
+}
@@ -0,0 +1,33 @@
+package dict
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAudioFormat(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"a.png", "b.css"}, ""},
+		{[]string{"a.wav", `\us\b.MP3`, "c.mp3", "d.png", "e.png", "f.png"}, "mp3"},
+	}
+	for _, tt := range tests {
+		if got := AudioFormat(slices.Values(tt.names)); got != tt.want {
+			t.Errorf("AudioFormat(%q) = %q, want %q", tt.names, got, tt.want)
+		}
+	}
+}
+
+func TestSoundLinks(t *testing.T) {
+	html := `<a href="sound://us/run.mp3">▶</a> <a href='sound://uk/run.mp3'>▶</a> <img src="run.png">`
+	want := []string{"us/run.mp3", "uk/run.mp3"}
+	if got := SoundLinks(html); !slices.Equal(got, want) {
+		t.Errorf("SoundLinks = %q, want %q", got, want)
+	}
+	if got := SoundLinks("<b>run</b>"); got != nil {
+		t.Errorf("SoundLinks without links = %q, want none", got)
+	}
+}
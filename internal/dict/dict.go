@@ -2,34 +2,76 @@ package dict
 
 import (
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
 )
 
 type Queryer interface {
 	Query(ctx context.Context, word string) ([]byte, error)
 }
 
+// BatchQueryer is implemented by dictionaries that can query many words at
+// once. The result maps each word to what Query would return for it; words
+// missing from the result should be queried one by one.
+type BatchQueryer interface {
+	QueryBatch(ctx context.Context, words []string) (map[string][]byte, error)
+}
+
+// Pronouncer pronounces a word, or any text such as an example sentence if
+// the dictionary declares PronounceCapabilities.Sentences.
 type Pronouncer interface {
 	Pronounce(ctx context.Context, word, accent, format string) (io.ReadCloser, error)
 }
 
 type QueryCapabilities struct {
 	AI bool
+
+	// WordForms is the path of the inflected forms of the word in the
+	// query result, if it has any. Arrays along the path are flattened.
+	WordForms []string
+
+	// BatchSize is the number of words to query at once with the
+	// BatchQueryer, or zero if batching is disabled.
+	BatchSize int
+
+	// Requires are the dictionaries whose results must be passed to Query
+	// with WithResults.
+	Requires []string
 }
 
 type PronounceCapabilities struct {
 	Accents []string // 支持的口音
 	Formats []string // 支持的音频格式
+
+	Sentences bool // 支持朗读任意文本，如例句
 }
 
+// MediaKind is a kind of media file that a dictionary can provide.
+type MediaKind string
+
+const (
+	MediaAudio MediaKind = "audio" // Pronounced by the Pronouncer.
+)
+
 type Capabilities struct {
 	Query     *QueryCapabilities
 	Pronounce *PronounceCapabilities
+	Media     []MediaKind
+}
+
+// HasMedia reports whether the dictionary provides media of the given kind.
+func (c *Capabilities) HasMedia(kind MediaKind) bool {
+	return slices.Contains(c.Media, kind)
 }
 
 type Dict struct {
@@ -38,6 +80,58 @@ type Dict struct {
 	Capabilities *Capabilities
 }
 
+// Entry is the wordlist entry of the word being queried. AI dictionaries
+// can use it to tailor their content.
+type Entry struct {
+	Deck  string // Path of the sub-deck, e.g. "Unit 1::Reading".
+	Tags  []string
+	Hints map[string]string // Such as the part of speech or intended sense.
+}
+
+type entryKey struct{}
+
+// WithEntry returns a copy of ctx carrying the wordlist entry of the word
+// being queried.
+func WithEntry(ctx context.Context, e *Entry) context.Context {
+	return context.WithValue(ctx, entryKey{}, e)
+}
+
+// EntryFrom returns the wordlist entry carried by ctx, or nil.
+func EntryFrom(ctx context.Context) *Entry {
+	e, _ := ctx.Value(entryKey{}).(*Entry)
+	return e
+}
+
+// Hints returns the wordlist hints carried by ctx, if any.
+func Hints(ctx context.Context) map[string]string {
+	if e := EntryFrom(ctx); e != nil {
+		return e.Hints
+	}
+	return nil
+}
+
+type resultsKey struct{}
+
+// WithResults returns a copy of ctx carrying the results of the other
+// dictionaries that a dictionary requires, by name.
+func WithResults(ctx context.Context, results map[string]any) context.Context {
+	return context.WithValue(ctx, resultsKey{}, results)
+}
+
+// Results returns the results of other dictionaries carried by ctx.
+func Results(ctx context.Context) map[string]any {
+	results, _ := ctx.Value(resultsKey{}).(map[string]any)
+	return results
+}
+
+// Varianter is implemented by queryers whose result depends on more than
+// the word and its hints, such as AI dictionaries with prompts tailored to
+// the deck. Variant returns a string that tells such results apart in the
+// cache, or "" for the result that depends on nothing else.
+type Varianter interface {
+	Variant(ctx context.Context, word string) (string, error)
+}
+
 type cachedQueryer struct {
 	dir string
 	Queryer
@@ -60,7 +154,11 @@ func (q *cachedQueryer) Query(ctx context.Context, word string) ([]byte, error)
 		return nil, err
 	}
 
-	path := filepath.Join(q.dir, fmt.Sprintf("%s.json", word))
+	key, err := q.cacheKey(ctx, word)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(q.dir, key+".json")
 	b, err := os.ReadFile(path)
 	switch {
 	case err == nil:
@@ -68,14 +166,106 @@ func (q *cachedQueryer) Query(ctx context.Context, word string) ([]byte, error)
 	case !errors.Is(err, fs.ErrNotExist):
 		return nil, err
 	default:
-		b, err = q.Queryer.Query(ctx, word)
+		stats := StatsFrom(ctx).child()
+		b, err = q.Queryer.Query(WithStats(ctx, stats), word)
 		if err != nil {
 			return nil, err
 		}
+		if err = writeUsage(path, stats.Usage()); err != nil {
+			return nil, err
+		}
 		return b, os.WriteFile(path, b, 0644)
 	}
 }
 
+// writeUsage stores next to the cache entry at path the tokens used to get it.
+func writeUsage(path string, usage map[string]Usage) error {
+	if len(usage) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(usage)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(strings.TrimSuffix(path, ".json")+".usage.json", b, 0644)
+}
+
+// QueryBatch returns the cached results of words, querying the missing ones
+// at once if the underlying dictionary is a BatchQueryer and caching them.
+func (q *cachedQueryer) QueryBatch(ctx context.Context, words []string) (map[string][]byte, error) {
+	results := make(map[string][]byte, len(words))
+	var missing []string
+	for _, word := range words {
+		key, err := q.cacheKey(ctx, word)
+		if err != nil {
+			return nil, err
+		}
+		path := filepath.Join(q.dir, key+".json")
+		b, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			results[word] = b
+		case errors.Is(err, fs.ErrNotExist):
+			missing = append(missing, word)
+		default:
+			return nil, err
+		}
+	}
+
+	bq, ok := q.Queryer.(BatchQueryer)
+	if !ok || len(missing) == 0 {
+		return results, nil
+	}
+	stats := StatsFrom(ctx).child()
+	batch, err := bq.QueryBatch(WithStats(ctx, stats), missing)
+	if err != nil {
+		return nil, err
+	}
+	var found []string
+	for _, word := range missing {
+		if _, ok := batch[word]; ok {
+			found = append(found, word)
+		}
+	}
+	usage := stats.Usage()
+	for i, word := range found {
+		b := batch[word]
+		key, err := q.cacheKey(ctx, word)
+		if err != nil {
+			return nil, err
+		}
+		path := filepath.Join(q.dir, key+".json")
+		if err = writeUsage(path, shareUsage(usage, i, len(found))); err != nil {
+			return nil, err
+		}
+		if err = os.WriteFile(path, b, 0644); err != nil {
+			return nil, err
+		}
+		results[word] = b
+	}
+	return results, nil
+}
+
+// shareUsage returns the share of the i-th of n words in the tokens of a
+// request. The tokens are shared equally, the first words taking the
+// remainder, so that the shares add up to the tokens of the request.
+func shareUsage(usage map[string]Usage, i, n int) map[string]Usage {
+	share := func(tokens int) int {
+		if i < tokens%n {
+			return tokens/n + 1
+		}
+		return tokens / n
+	}
+	shares := make(map[string]Usage, len(usage))
+	for name, u := range usage {
+		shares[name] = Usage{
+			PromptTokens:     share(u.PromptTokens),
+			CompletionTokens: share(u.CompletionTokens),
+		}
+	}
+	return shares
+}
+
 type cachedPronouncer struct {
 	dir string
 	Pronouncer
@@ -98,7 +288,7 @@ func (cp *cachedPronouncer) Pronounce(ctx context.Context, word, accent, format
 		return nil, err
 	}
 
-	path := filepath.Join(cp.dir, fmt.Sprintf("%s_%s.%s", word, accent, format))
+	path := filepath.Join(cp.dir, audioFile(word, accent, format))
 	f, err := os.Open(path)
 	switch {
 	case err == nil:
@@ -110,18 +300,23 @@ func (cp *cachedPronouncer) Pronounce(ctx context.Context, word, accent, format
 		if err != nil {
 			return nil, err
 		}
-		w, err := os.Create(path)
+		w, err := os.CreateTemp(cp.dir, filepath.Base(path)+".*.tmp")
 		if err != nil {
 			_ = audio.Close()
 			return nil, err
 		}
-		return &teeReadCloser{r: audio, w: w}, nil
+		return &teeReadCloser{r: audio, w: w, path: path}, nil
 	}
 }
 
+// teeReadCloser writes what it reads into a temporary file, which is moved
+// to path on Close only if the whole audio was read, so that a canceled or
+// failed download never leaves a truncated file in the cache.
 type teeReadCloser struct {
-	r io.ReadCloser
-	w io.WriteCloser
+	r    io.ReadCloser
+	w    *os.File
+	path string
+	eof  bool
 }
 
 func (t *teeReadCloser) Read(p []byte) (n int, err error) {
@@ -131,9 +326,75 @@ func (t *teeReadCloser) Read(p []byte) (n int, err error) {
 			return n, err
 		}
 	}
+	if err == io.EOF {
+		t.eof = true
+	}
 	return
 }
 
 func (t *teeReadCloser) Close() error {
-	return errors.Join(t.r.Close(), t.w.Close())
+	err := errors.Join(t.r.Close(), t.w.Close())
+	if err == nil && t.eof {
+		return os.Rename(t.w.Name(), t.path)
+	}
+	return errors.Join(err, os.Remove(t.w.Name()))
+}
+
+// Variant passes on the variant of the underlying queryer, so that it can
+// be wrapped again, e.g. by a RecordingQueryer.
+func (q *cachedQueryer) Variant(ctx context.Context, word string) (string, error) {
+	return variant(ctx, q.Queryer, word)
+}
+
+// variant returns the variant of the result of q for word, see Varianter.
+func variant(ctx context.Context, q Queryer, word string) (string, error) {
+	if v, ok := q.(Varianter); ok {
+		return v.Variant(ctx, word)
+	}
+	return "", nil
+}
+
+// cacheKey returns the cache file name (without extension) for word,
+// distinguishing queries made with different hints or variants.
+func (q *cachedQueryer) cacheKey(ctx context.Context, word string) (string, error) {
+	return resultKey(ctx, q.Queryer, word)
+}
+
+// resultKey returns the file name (without extension) of the result of q
+// for word in a cache or recording.
+func resultKey(ctx context.Context, q Queryer, word string) (string, error) {
+	variant, err := variant(ctx, q, word)
+	if err != nil {
+		return "", err
+	}
+
+	key := fileKey(word)
+	hints := Hints(ctx)
+	if len(hints) == 0 && variant == "" {
+		return key, nil
+	}
+	b := fmt.Append(nil, hints)
+	if variant != "" {
+		b = fmt.Append(b, "\x00", variant)
+	}
+	sum := sha1.Sum(b)
+	return fmt.Sprintf("%s.%s", key, hex.EncodeToString(sum[:4])), nil
+}
+
+// audioFile returns the file name of the pronunciation of word in a cache
+// or recording.
+func audioFile(word, accent, format string) string {
+	return fmt.Sprintf("%s_%s.%s", fileKey(word), accent, format)
+}
+
+// fileKey returns text if it can be used as part of a file name, or a hash
+// of it otherwise, e.g. for a sentence, a path such as "../x" or a name
+// that would be hidden.
+func fileKey(text string) string {
+	if text != "" && len(text) <= 64 && !strings.HasPrefix(text, ".") &&
+		!strings.ContainsAny(text, `/\:*?"<>|`) && !strings.ContainsFunc(text, unicode.IsControl) {
+		return text
+	}
+	sum := sha1.Sum([]byte(text))
+	return hex.EncodeToString(sum[:8])
 }
@@ -0,0 +1,139 @@
+package dict
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type echoQueryer struct{}
+
+func (echoQueryer) Query(ctx context.Context, word string) ([]byte, error) {
+	return []byte(`{}`), nil
+}
+
+// TestCachedQueryerFileNames checks that words unfit for file names are
+// cached inside the cache directory.
+func TestCachedQueryerFileNames(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "cache")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	q := CachedQueryer(dir, echoQueryer{})
+
+	words := []string{"apple", "../escape", "..", "a/b", `c:\d`, strings.Repeat("long phrase ", 10), ""}
+	for _, word := range words {
+		if _, err := q.Query(context.Background(), word); err != nil {
+			t.Fatalf("Query(%q): %v", word, err)
+		}
+	}
+	ctx := WithEntry(context.Background(), &Entry{Hints: map[string]string{"pos": "n."}})
+	if _, err := q.Query(ctx, "../escape"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("files written outside the cache directory: %v", entries)
+	}
+	entries, err = os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(words)+1 {
+		t.Errorf("got %d cache files, want %d", len(entries), len(words)+1)
+	}
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			t.Errorf("unexpected cache file %q", e.Name())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "apple.json")); err != nil {
+		t.Error("apple is not cached under its own name")
+	}
+}
+
+// batchQueryer answers batches of words, using the same tokens for each.
+type batchQueryer struct {
+	echoQueryer
+	batches [][]string
+}
+
+func (q *batchQueryer) QueryBatch(ctx context.Context, words []string) (map[string][]byte, error) {
+	q.batches = append(q.batches, words)
+	StatsFrom(ctx).AddUsage("ai", Usage{PromptTokens: 100, CompletionTokens: 11})
+	results := make(map[string][]byte)
+	for _, word := range words {
+		if word != "missing" {
+			results[word] = []byte(`"` + word + `"`)
+		}
+	}
+	return results, nil
+}
+
+func TestCachedQueryerBatch(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "cached.json"), []byte(`"old"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bq := &batchQueryer{}
+	q := CachedQueryer(dir, bq).(BatchQueryer)
+
+	stats := NewStats(0)
+	ctx := WithStats(context.Background(), stats)
+	words := []string{"a", "cached", "b", "missing", "c"}
+	results, err := q.QueryBatch(ctx, words)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a": `"a"`, "b": `"b"`, "c": `"c"`, "cached": `"old"`}
+	if len(results) != len(want) {
+		t.Errorf("got %d results, want %d", len(results), len(want))
+	}
+	for word, v := range want {
+		if string(results[word]) != v {
+			t.Errorf("result of %q = %s, want %s", word, results[word], v)
+		}
+	}
+	if len(bq.batches) != 1 || strings.Join(bq.batches[0], " ") != "a b missing c" {
+		t.Errorf("batches = %q, want only the uncached words", bq.batches)
+	}
+	if u := stats.TotalUsage(); u != (Usage{100, 11}) {
+		t.Errorf("total usage = %+v, want that of the request", u)
+	}
+
+	// The tokens of the request are shared by the words it answered.
+	var sum Usage
+	for _, word := range []string{"a", "b", "c"} {
+		b, err := os.ReadFile(filepath.Join(dir, word+".usage.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var usage map[string]Usage
+		if err = json.Unmarshal(b, &usage); err != nil {
+			t.Fatal(err)
+		}
+		u := usage["ai"]
+		if u.PromptTokens < 33 || u.PromptTokens > 34 || u.CompletionTokens < 3 || u.CompletionTokens > 4 {
+			t.Errorf("usage of %q = %+v, want a third of the request", word, u)
+		}
+		sum = sum.add(u)
+	}
+	if sum != (Usage{100, 11}) {
+		t.Errorf("usage of the words adds up to %+v, want %+v", sum, Usage{100, 11})
+	}
+
+	if _, err = q.QueryBatch(ctx, []string{"a", "b", "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(bq.batches) != 1 {
+		t.Errorf("cached words were queried again: %q", bq.batches[1:])
+	}
+}
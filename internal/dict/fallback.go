@@ -0,0 +1,207 @@
+package dict
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/lftk/anki-vocab/internal/tmpljson"
+)
+
+// ErrNotFound is returned when a dictionary has nothing for a word.
+var ErrNotFound = errors.New("not found")
+
+// FallbackMember is a dictionary in a fallback chain.
+type FallbackMember struct {
+	Name string
+	Dict *Dict
+
+	// Require is the path of a value in the query result that must be
+	// non-empty for the result to be used, e.g. ["ec", "word", "trs"].
+	// If empty, the result must be a non-empty object.
+	Require []string
+}
+
+// Fallback returns a dictionary that tries each member in order and uses the
+// first one that succeeds. If optional is true, an exhausted chain yields an
+// empty result instead of an error.
+func Fallback(members []*FallbackMember, optional bool) *Dict {
+	fq := &fallbackQueryer{optional: optional}
+	fp := &fallbackPronouncer{optional: optional}
+
+	caps := new(Capabilities)
+	for _, m := range members {
+		if m.Dict.Queryer != nil && m.Dict.Capabilities.Query != nil {
+			fq.members = append(fq.members, m)
+			if caps.Query == nil {
+				caps.Query = &QueryCapabilities{}
+			}
+			// Any member may be queried, with the results it requires and,
+			// if it is an AI dictionary, the wordlist entry. The chain is
+			// not batched though, as later members are only queried for
+			// the words that earlier ones lack.
+			caps.Query.Requires = appendNew(caps.Query.Requires, m.Dict.Capabilities.Query.Requires...)
+			caps.Query.AI = caps.Query.AI || m.Dict.Capabilities.Query.AI
+		}
+		if m.Dict.Pronouncer != nil && m.Dict.Capabilities.Pronounce != nil {
+			fp.members = append(fp.members, m)
+			if caps.Pronounce == nil {
+				caps.Pronounce = &PronounceCapabilities{Sentences: true}
+			}
+			pc := m.Dict.Capabilities.Pronounce
+			// Any member may be asked to pronounce a sentence.
+			caps.Pronounce.Sentences = caps.Pronounce.Sentences && pc.Sentences
+			caps.Pronounce.Accents = appendNew(caps.Pronounce.Accents, pc.Accents...)
+			caps.Pronounce.Formats = appendNew(caps.Pronounce.Formats, pc.Formats...)
+		}
+		caps.Media = appendNew(caps.Media, m.Dict.Capabilities.Media...)
+	}
+
+	d := &Dict{Capabilities: caps}
+	if caps.Query != nil {
+		d.Queryer = fq
+	}
+	if caps.Pronounce != nil {
+		d.Pronouncer = fp
+	}
+	return d
+}
+
+type fallbackQueryer struct {
+	members  []*FallbackMember
+	optional bool
+}
+
+func (q *fallbackQueryer) Query(ctx context.Context, word string) ([]byte, error) {
+	var errs []error
+	for _, m := range q.members {
+		b, err := m.Dict.Queryer.Query(ctx, word)
+		if err == nil {
+			if m.Dict.Capabilities.Query.AI {
+				b = Unquote(b)
+			}
+			b, err = requireValue(b, m.Require)
+		}
+		if err == nil {
+			return b, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", m.Name, err))
+	}
+	if q.optional {
+		return []byte("{}"), nil
+	}
+	return nil, exhausted(errs)
+}
+
+// requireValue returns b if the value at path in the JSON object b is not empty.
+func requireValue(b []byte, path []string) ([]byte, error) {
+	nb, err := tmpljson.Normalize(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var v any
+	if err = json.Unmarshal(nb, &v); err != nil {
+		return nil, err
+	}
+	if _, ok := v.(map[string]any); !ok {
+		return nil, errors.New("result is not an object")
+	}
+
+	for _, key := range path {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, ErrNotFound
+		}
+		v = m[key]
+	}
+
+	switch v := v.(type) {
+	case nil:
+		return nil, ErrNotFound
+	case string:
+		if v == "" {
+			return nil, ErrNotFound
+		}
+	case []any:
+		if len(v) == 0 {
+			return nil, ErrNotFound
+		}
+	case map[string]any:
+		if len(v) == 0 {
+			return nil, ErrNotFound
+		}
+	}
+	return b, nil
+}
+
+type fallbackPronouncer struct {
+	members  []*FallbackMember
+	optional bool
+}
+
+func (p *fallbackPronouncer) Pronounce(ctx context.Context, word, accent, format string) (io.ReadCloser, error) {
+	var errs []error
+	for _, m := range p.members {
+		caps := m.Dict.Capabilities.Pronounce
+		if !slices.Contains(caps.Accents, accent) {
+			continue
+		}
+		if len(caps.Formats) > 0 && !slices.Contains(caps.Formats, format) {
+			continue
+		}
+
+		audio, err := m.Dict.Pronouncer.Pronounce(ctx, word, accent, format)
+		if err == nil {
+			return audio, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", m.Name, err))
+	}
+	if p.optional || len(errs) == 0 {
+		return nil, ErrNotFound
+	}
+	return nil, exhausted(errs)
+}
+
+// exhausted returns the error of a chain whose members all failed. It is
+// not ErrNotFound even if no member found the word: only a chain ending in
+// none yields an empty result.
+func exhausted(errs []error) error {
+	for i, err := range errs {
+		if errors.Is(err, ErrNotFound) {
+			errs[i] = errors.New(err.Error())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Unquote strips the Markdown code fence that AI models sometimes wrap
+// around JSON.
+func Unquote(b []byte) []byte {
+	b = bytes.TrimSpace(b)
+	if bytes.HasPrefix(b, []byte("```")) && bytes.HasSuffix(b, []byte("```")) {
+		b = b[3 : len(b)-3]
+		b = bytes.TrimPrefix(b, []byte("json"))
+		return bytes.TrimSpace(b)
+	}
+	return b
+}
+
+func appendNew[S ~[]E, E comparable](s S, elems ...E) S {
+	for _, e := range elems {
+		if !slices.Contains(s, e) {
+			s = append(s, e)
+		}
+	}
+	return s
+}
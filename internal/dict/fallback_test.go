@@ -0,0 +1,47 @@
+package dict
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type errQueryer struct{ err error }
+
+func (q errQueryer) Query(ctx context.Context, word string) ([]byte, error) {
+	return nil, q.err
+}
+
+func fallbackOf(optional bool, errs ...error) *Dict {
+	var members []*FallbackMember
+	for _, err := range errs {
+		members = append(members, &FallbackMember{
+			Name: "member",
+			Dict: &Dict{
+				Queryer:      errQueryer{err},
+				Capabilities: &Capabilities{Query: &QueryCapabilities{}},
+			},
+		})
+	}
+	return Fallback(members, optional)
+}
+
+func TestFallbackExhausted(t *testing.T) {
+	ctx := context.Background()
+	failed := errors.New("failed")
+
+	// Only a chain ending in none yields an empty result.
+	_, err := fallbackOf(false, ErrNotFound, ErrNotFound).Queryer.Query(ctx, "pear")
+	if err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("exhausted chain: err = %v, want an error other than %v", err, ErrNotFound)
+	}
+	_, err = fallbackOf(false, ErrNotFound, failed).Queryer.Query(ctx, "pear")
+	if !errors.Is(err, failed) || errors.Is(err, ErrNotFound) {
+		t.Errorf("exhausted chain: err = %v, want %v only", err, failed)
+	}
+
+	b, err := fallbackOf(true, ErrNotFound, failed).Queryer.Query(ctx, "pear")
+	if err != nil || string(b) != "{}" {
+		t.Errorf("exhausted optional chain = %s, %v, want {}", b, err)
+	}
+}
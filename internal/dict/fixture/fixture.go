@@ -0,0 +1,111 @@
+// Package fixture implements a dictionary that answers from a directory of
+// JSON and audio files, such as one recorded with --record, so that decks
+// and templates can be tested without any network.
+package fixture
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/lftk/anki-vocab/internal/dict"
+)
+
+type Config struct {
+	// Dir holds the result of each word in <word>.json and its
+	// pronunciations in <word>_<accent>.<format>, e.g. apple.json and
+	// apple_us.mp3, laid out like the cache. Words unfit for file names,
+	// such as long phrases, are replaced by a hash.
+	Dir string `yaml:"dir"`
+
+	// Accents are the accents of the pronunciations, ["us"] by default.
+	Accents []string `yaml:"accents"`
+
+	// Format is the format of the pronunciations, "mp3" by default.
+	Format string `yaml:"format"`
+
+	// Sentences declares that the directory also holds pronunciations of
+	// sentences, see dict.PronounceCapabilities.Sentences.
+	Sentences bool `yaml:"sentences"`
+
+	// WordForms is the path of the inflected forms of the word in a
+	// result, see dict.QueryCapabilities.WordForms.
+	WordForms string `yaml:"word_forms"`
+}
+
+const defaultFormat = "mp3"
+
+func New(cfg *Config) (*dict.Dict, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("dir is required")
+	}
+	fi, err := os.Stat(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", cfg.Dir)
+	}
+
+	accents := cfg.Accents
+	if len(accents) == 0 {
+		accents = []string{dict.DefaultAccent}
+	}
+	format := cfg.Format
+	if format == "" {
+		format = defaultFormat
+	}
+
+	d := &Dict{
+		q: dict.ReplayQueryer(cfg.Dir, nil),
+		p: dict.ReplayPronouncer(cfg.Dir),
+	}
+	caps := &dict.Capabilities{
+		Query: &dict.QueryCapabilities{},
+		Pronounce: &dict.PronounceCapabilities{
+			Accents:   accents,
+			Formats:   []string{format},
+			Sentences: cfg.Sentences,
+		},
+		Media: []dict.MediaKind{dict.MediaAudio},
+	}
+	if cfg.WordForms != "" {
+		caps.Query.WordForms = strings.Split(cfg.WordForms, ".")
+	}
+	return &dict.Dict{Queryer: d, Pronouncer: d, Capabilities: caps}, nil
+}
+
+// Dict replays the files of a directory, reporting the words and
+// pronunciations missing from it as not found.
+type Dict struct {
+	q dict.Queryer
+	p dict.Pronouncer
+}
+
+func (d *Dict) Query(ctx context.Context, word string) ([]byte, error) {
+	b, err := d.q.Query(ctx, word)
+	if err != nil {
+		return nil, notFound(word, err)
+	}
+	return b, nil
+}
+
+func (d *Dict) Pronounce(ctx context.Context, word, accent, format string) (io.ReadCloser, error) {
+	r, err := d.p.Pronounce(ctx, word, accent, format)
+	if err != nil {
+		return nil, notFound(word, err)
+	}
+	return r, nil
+}
+
+// notFound turns ErrNotRecorded into dict.ErrNotFound: unlike a replayed
+// dictionary, a fixture is not expected to hold every word.
+func notFound(word string, err error) error {
+	if errors.Is(err, dict.ErrNotRecorded) {
+		return fmt.Errorf("%q: %w", word, dict.ErrNotFound)
+	}
+	return err
+}
@@ -0,0 +1,63 @@
+package fixture
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lftk/anki-vocab/internal/dict"
+)
+
+func TestFixture(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"apple.json":   `{"word": "apple"}`,
+		"apple_us.mp3": "ID3 apple",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d, err := New(&Config{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	b, err := d.Queryer.Query(ctx, "apple")
+	if err != nil || string(b) != files["apple.json"] {
+		t.Errorf("Query(%q) = %s, %v, want %s", "apple", b, err, files["apple.json"])
+	}
+	r, err := d.Pronouncer.Pronounce(ctx, "apple", "us", "mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if b, err = io.ReadAll(r); err != nil || string(b) != files["apple_us.mp3"] {
+		t.Errorf("Pronounce(%q) = %q, %v, want %q", "apple", b, err, files["apple_us.mp3"])
+	}
+
+	// Unlike replayed dictionaries, fixtures need not hold every word.
+	if _, err = d.Queryer.Query(ctx, "pear"); !errors.Is(err, dict.ErrNotFound) {
+		t.Errorf("Query(%q): err = %v, want %v", "pear", err, dict.ErrNotFound)
+	}
+	if _, err = d.Pronouncer.Pronounce(ctx, "apple", "uk", "mp3"); !errors.Is(err, dict.ErrNotFound) {
+		t.Errorf("Pronounce(%q) in uk accent: err = %v, want %v", "apple", err, dict.ErrNotFound)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "apple.json")
+	if err := os.WriteFile(file, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"", file, filepath.Join(t.TempDir(), "missing")} {
+		if _, err := New(&Config{Dir: dir}); err == nil {
+			t.Errorf("New(%q) succeeded, want an error", dir)
+		}
+	}
+}
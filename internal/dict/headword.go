@@ -0,0 +1,19 @@
+package dict
+
+import (
+	"strings"
+
+	"github.com/lftk/anki-vocab/internal/inflect"
+	"github.com/lftk/anki-vocab/internal/utils"
+)
+
+// Headwords returns the headwords to look word up under in a dictionary
+// file, in order: the word itself, in lower case and, unless exact, its
+// likely base forms, e.g. "run" for "ran" or "running".
+func Headwords(word string, exact bool) []string {
+	words := []string{word, strings.ToLower(word)}
+	if !exact {
+		words = append(words, inflect.Lemmas(word)...)
+	}
+	return utils.SliceUnique(words)
+}
@@ -0,0 +1,157 @@
+package local
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strings"
+)
+
+// index maps the words of a data file to the offsets of their records, so
+// that only the records looked up are read and kept in memory.
+type index struct {
+	f       *os.File
+	offsets map[string]int64
+
+	// read reads the record at the start of r as a JSON object.
+	read func(r io.Reader) ([]byte, error)
+}
+
+func (x *index) lookup(ctx context.Context, word string) ([]byte, error) {
+	off, ok := x.offsets[word]
+	if !ok {
+		return nil, nil
+	}
+	b, err := x.read(io.NewSectionReader(x.f, off, math.MaxInt64-off))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", x.f.Name(), err)
+	}
+	return b, nil
+}
+
+// add indexes the record at off, unless word already has one.
+func (x *index) add(word string, off int64) {
+	if _, ok := x.offsets[word]; !ok && word != "" {
+		x.offsets[word] = off
+	}
+}
+
+// openCSV indexes a CSV file whose first row names the fields.
+func openCSV(path, field string) (_ *index, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			err = fmt.Errorf("%s: %w", path, err)
+		}
+	}()
+
+	r := newCSVReader(f)
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	header = slices.Clone(header)
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	col := slices.Index(header, field)
+	if col < 0 {
+		return nil, fmt.Errorf("no %q column", field)
+	}
+
+	x := &index{
+		f:       f,
+		offsets: make(map[string]int64),
+		read: func(r io.Reader) ([]byte, error) {
+			rec, err := newCSVReader(r).Read()
+			if err != nil {
+				return nil, err
+			}
+			m := make(map[string]string, len(header))
+			for i, name := range header[:min(len(header), len(rec))] {
+				m[name] = rec[i]
+			}
+			return json.Marshal(m)
+		},
+	}
+	for {
+		off := r.InputOffset()
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if col < len(rec) {
+			x.add(rec[col], off)
+		}
+	}
+	return x, nil
+}
+
+func newCSVReader(r io.Reader) *csv.Reader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	cr.ReuseRecord = true
+	return cr
+}
+
+// openJSONL indexes a file of JSON objects, one per line.
+func openJSONL(path, field string) (_ *index, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			err = fmt.Errorf("%s: %w", path, err)
+		}
+	}()
+
+	x := &index{
+		f:       f,
+		offsets: make(map[string]int64),
+		read: func(r io.Reader) ([]byte, error) {
+			line, err := bufio.NewReader(r).ReadBytes('\n')
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+			return bytes.TrimSpace(line), nil
+		},
+	}
+
+	br := bufio.NewReader(f)
+	var off int64
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var rec map[string]any
+			if err := json.Unmarshal(line, &rec); err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			word, _ := rec[field].(string)
+			x.add(word, off)
+		}
+		off += int64(len(line))
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return x, nil
+}
@@ -0,0 +1,108 @@
+// Package local implements a dictionary that answers queries from a data
+// file, such as those of ECDICT, so that decks can be built offline.
+package local
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/lftk/anki-vocab/internal/dict"
+)
+
+type Config struct {
+	// Path is the data file: a CSV file with a header row, such as
+	// ecdict.csv, a file of JSON objects one per line, or a SQLite
+	// database, such as stardict.db.
+	Path string `yaml:"path"`
+
+	// Format is "csv", "jsonl" or "sqlite". If empty, it is inferred from
+	// the extension of Path.
+	Format string `yaml:"format"`
+
+	// WordField is the field, or column, holding the word, "word" by default.
+	WordField string `yaml:"word_field"`
+
+	// Table is the table of a SQLite database, "stardict" by default.
+	Table string `yaml:"table"`
+
+	// WordForms is the path of the inflected forms of the word in a
+	// record, e.g. "forms", see dict.QueryCapabilities.WordForms.
+	WordForms string `yaml:"word_forms"`
+
+	// Exact disables the lookup of the base forms of words without a
+	// record, e.g. of "ran" in the record of "run", for data files whose
+	// inflected words have records of their own.
+	Exact bool `yaml:"exact"`
+}
+
+const (
+	defaultWordField = "word"
+	defaultTable     = "stardict"
+)
+
+// New opens the data file of cfg, indexing the words of CSV and JSON lines
+// files, whose records are then read on demand.
+func New(cfg *Config) (*dict.Dict, error) {
+	format := cfg.Format
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(cfg.Path), ".")
+	}
+	field := cmp.Or(cfg.WordField, defaultWordField)
+
+	var (
+		src source
+		err error
+	)
+	switch format {
+	case "csv":
+		src, err = openCSV(cfg.Path, field)
+	case "jsonl", "ndjson":
+		src, err = openJSONL(cfg.Path, field)
+	case "sqlite", "db", "sqlite3":
+		src, err = openSQLite(cfg.Path, cmp.Or(cfg.Table, defaultTable), field)
+	default:
+		return nil, fmt.Errorf("unsupported data file format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Dict{src: src, exact: cfg.Exact}
+	caps := &dict.Capabilities{
+		Query: &dict.QueryCapabilities{},
+	}
+	if cfg.WordForms != "" {
+		caps.Query.WordForms = strings.Split(cfg.WordForms, ".")
+	}
+	return &dict.Dict{Queryer: d, Capabilities: caps}, nil
+}
+
+// source looks up the records of a data file.
+type source interface {
+	// lookup returns the record of word as a JSON object, or nil if there
+	// is none.
+	lookup(ctx context.Context, word string) ([]byte, error)
+}
+
+type Dict struct {
+	src   source
+	exact bool
+}
+
+// Query returns the record of word, or failing that, of the word in lower
+// case or of its base form.
+func (d *Dict) Query(ctx context.Context, word string) ([]byte, error) {
+	for _, w := range dict.Headwords(word, d.exact) {
+		b, err := d.src.lookup(ctx, w)
+		if err != nil {
+			return nil, err
+		}
+		if b != nil {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("%q: %w", word, dict.ErrNotFound)
+}
@@ -0,0 +1,108 @@
+package local
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/lftk/anki-vocab/internal/dict"
+)
+
+// createSQLite creates a database holding the words of testdata/words.csv.
+func createSQLite(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "words.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec(`
+		CREATE TABLE stardict (word TEXT, phonetic TEXT, translation TEXT);
+		CREATE INDEX stardict_word ON stardict (word);
+		INSERT INTO stardict VALUES
+			('apple', 'ˈæpl', 'n. 苹果'),
+			('run', 'rʌn', 'v. 跑\nn. 跑步'),
+			('give up', '', 'v. 放弃');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestQuery(t *testing.T) {
+	paths := map[string]string{
+		"csv":    "testdata/words.csv",
+		"jsonl":  "testdata/words.jsonl",
+		"sqlite": createSQLite(t),
+	}
+	tests := []struct {
+		word string
+		want string // The word of the record, or "" if none is found.
+	}{
+		{"apple", "apple"},
+		{"Apple", "apple"},
+		{"ran", "run"},
+		{"running", "run"},
+		{"gave up", "give up"},
+		{"pear", ""},
+		{"", ""},
+	}
+	for format, path := range paths {
+		d, err := New(&Config{Path: path, Format: format})
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		for _, tt := range tests {
+			b, err := d.Queryer.Query(context.Background(), tt.word)
+			if tt.want == "" {
+				if !errors.Is(err, dict.ErrNotFound) {
+					t.Errorf("%s: Query(%q) = %s, %v, want %v", format, tt.word, b, err, dict.ErrNotFound)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: Query(%q): %v", format, tt.word, err)
+				continue
+			}
+			var rec map[string]any
+			if err = json.Unmarshal(b, &rec); err != nil {
+				t.Fatalf("%s: Query(%q) = %s: %v", format, tt.word, b, err)
+			}
+			if rec["word"] != tt.want {
+				t.Errorf("%s: Query(%q) = %s, want the record of %q", format, tt.word, b, tt.want)
+			}
+		}
+	}
+}
+
+func TestQueryExact(t *testing.T) {
+	d, err := New(&Config{Path: "testdata/words.csv", Exact: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Queryer.Query(context.Background(), "Apple"); err != nil {
+		t.Errorf("Query(%q): %v", "Apple", err)
+	}
+	if _, err = d.Queryer.Query(context.Background(), "running"); !errors.Is(err, dict.ErrNotFound) {
+		t.Errorf("Query(%q): err = %v, want %v", "running", err, dict.ErrNotFound)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []*Config{
+		{Path: "testdata/words.txt"},
+		{Path: "testdata/missing.csv"},
+		{Path: "testdata/words.csv", WordField: "headword"},
+		{Path: filepath.Join(t.TempDir(), "missing.db")},
+	}
+	for _, cfg := range tests {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("New(%+v) succeeded, want an error", cfg)
+		}
+	}
+}
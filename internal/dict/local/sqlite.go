@@ -0,0 +1,73 @@
+package local
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteSource looks up the records of a table of a SQLite database, using
+// the indexes of the database.
+type sqliteSource struct {
+	stmt *sql.Stmt
+}
+
+func openSQLite(path, table, field string) (*sqliteSource, error) {
+	// Opening a missing database would create it.
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf("SELECT * FROM %s WHERE %s = ? LIMIT 1", quoteIdent(table), quoteIdent(field))
+	stmt, err := db.Prepare(query)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &sqliteSource{stmt: stmt}, nil
+}
+
+func (s *sqliteSource) lookup(ctx context.Context, word string) ([]byte, error) {
+	rows, err := s.stmt.QueryContext(ctx, word)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	vals := make([]any, len(cols))
+	ptrs := make([]any, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	if err = rows.Scan(ptrs...); err != nil {
+		return nil, err
+	}
+
+	rec := make(map[string]any, len(cols))
+	for i, col := range cols {
+		if b, ok := vals[i].([]byte); ok {
+			vals[i] = string(b)
+		}
+		rec[col] = vals[i]
+	}
+	return json.Marshal(rec)
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
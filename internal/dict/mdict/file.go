@@ -0,0 +1,509 @@
+package mdict
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// file is an MDX file of definitions or an MDD file of resources. Both
+// consist of a header, an index of keys, whose entries are the offsets of
+// their records in the concatenation of the record blocks, and the record
+// blocks, each compressed separately.
+type file struct {
+	f        *os.File
+	encoding encoding.Encoding // Of keys and, in MDX files, of records.
+	wide     bool              // Whether the encoding is UTF-16.
+
+	// keys maps keys, in lower case, to their records.
+	keys map[string][]span
+
+	blocks []recordBlock
+
+	mu    sync.Mutex
+	cache struct {
+		block int
+		data  []byte
+	}
+}
+
+// span is the location of a record in the concatenation of record blocks.
+type span struct {
+	offset, size int64
+}
+
+type recordBlock struct {
+	offset     int64 // Of the compressed block in the file.
+	size       int64 // Compressed.
+	dataOffset int64 // In the concatenation of record blocks.
+	dataSize   int64
+}
+
+// sizes of the numbers in version 1 and 2 files.
+type widths struct {
+	number int // Counts, sizes and offsets.
+	text   int // Sizes of the first and last keys of key blocks.
+	term   int // Whether these keys are NUL-terminated.
+}
+
+var attrPattern = regexp.MustCompile(`(\w+)="(.*?)"`)
+
+// openFile opens an MDX file, or an MDD file if mdd, reading its index.
+func openFile(path string, mdd bool) (_ *file, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			err = fmt.Errorf("%s: %w", path, err)
+		}
+	}()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	r := &offsetReader{r: f, size: fi.Size()}
+
+	// The header is an XML element in UTF-16, followed by its checksum.
+	n, err := r.uint(4)
+	if err != nil {
+		return nil, err
+	}
+	b, err := r.read(int64(n))
+	if err != nil {
+		return nil, err
+	}
+	if _, err = r.read(4); err != nil {
+		return nil, err
+	}
+	header, err := decode(utf16, b)
+	if err != nil {
+		return nil, err
+	}
+	attrs := make(map[string]string)
+	for _, m := range attrPattern.FindAllStringSubmatch(header, -1) {
+		attrs[m[1]] = m[2]
+	}
+
+	version, _ := strconv.ParseFloat(attrs["GeneratedByEngineVersion"], 64)
+	if version >= 3 {
+		return nil, fmt.Errorf("unsupported MDict version %s", attrs["GeneratedByEngineVersion"])
+	}
+	w := widths{number: 8, text: 2, term: 1}
+	if version < 2 {
+		w = widths{number: 4, text: 1, term: 0}
+	}
+
+	var encrypted int
+	switch attrs["Encrypted"] {
+	case "", "No":
+	case "Yes":
+		encrypted = 1
+	default:
+		encrypted, _ = strconv.Atoi(attrs["Encrypted"])
+	}
+	if encrypted&1 != 0 {
+		return nil, errors.New("dictionaries encrypted with a registration code are not supported")
+	}
+
+	mf := &file{f: f}
+	name := attrs["Encoding"]
+	if mdd {
+		name = "UTF-16"
+	}
+	if mf.encoding, err = textEncoding(name); err != nil {
+		return nil, err
+	}
+	mf.wide = mf.encoding == utf16
+	if err = mf.readKeys(r, w, encrypted&2 != 0); err != nil {
+		return nil, err
+	}
+	if err = mf.readRecordBlocks(r, w); err != nil {
+		return nil, err
+	}
+	mf.cache.block = -1
+	return mf, nil
+}
+
+var utf16 = unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+
+func textEncoding(name string) (encoding.Encoding, error) {
+	switch strings.ToUpper(name) {
+	case "", "UTF-8", "UTF8":
+		return nil, nil
+	case "UTF-16", "UTF16":
+		return utf16, nil
+	case "GBK", "GB2312", "GB18030":
+		return simplifiedchinese.GB18030, nil
+	case "BIG5", "BIG-5":
+		return traditionalchinese.Big5, nil
+	}
+	return nil, fmt.Errorf("unsupported encoding %q", name)
+}
+
+func decode(enc encoding.Encoding, b []byte) (string, error) {
+	if enc == nil {
+		return string(b), nil
+	}
+	b, err := enc.NewDecoder().Bytes(b)
+	return string(b), err
+}
+
+// charWidth returns the size of the NUL character in the key encoding.
+func (mf *file) charWidth() int {
+	if mf.wide {
+		return 2
+	}
+	return 1
+}
+
+// readKeys reads the key section: its sizes, the info of the key blocks,
+// optionally encrypted, and the key blocks.
+func (mf *file) readKeys(r *offsetReader, w widths, encryptedInfo bool) error {
+	var sizes []uint64
+	count := 4
+	if w.number == 8 {
+		// Also the size of the decompressed key block info.
+		count = 5
+	}
+	for range count {
+		n, err := r.uint(w.number)
+		if err != nil {
+			return err
+		}
+		sizes = append(sizes, n)
+	}
+	if w.number == 8 {
+		// Checksum of the sizes.
+		if _, err := r.read(4); err != nil {
+			return err
+		}
+	}
+	numBlocks, infoSize, blocksSize := sizes[0], sizes[len(sizes)-2], sizes[len(sizes)-1]
+
+	info, err := r.read(int64(infoSize))
+	if err != nil {
+		return err
+	}
+	if w.number == 8 {
+		if encryptedInfo {
+			info = decryptKeyInfo(info)
+		}
+		if info, err = decompress(info); err != nil {
+			return fmt.Errorf("key block info: %w", err)
+		}
+	}
+
+	// Only the compressed sizes of the key blocks are needed.
+	cw := mf.charWidth()
+	ir := &offsetReader{r: bytes.NewReader(info), size: int64(len(info))}
+	var blockSizes []int64
+	for range numBlocks {
+		if _, err := ir.uint(w.number); err != nil { // Number of entries.
+			return err
+		}
+		for range 2 { // First and last keys.
+			n, err := ir.uint(w.text)
+			if err != nil {
+				return err
+			}
+			size := int64(n) + int64(w.term)
+			if _, err = ir.read(size * int64(cw)); err != nil {
+				return err
+			}
+		}
+		size, err := ir.uint(w.number)
+		if err != nil {
+			return err
+		}
+		if _, err = ir.uint(w.number); err != nil { // Decompressed size.
+			return err
+		}
+		if size > blocksSize {
+			return errors.New("key block beyond the key blocks")
+		}
+		blockSizes = append(blockSizes, int64(size))
+	}
+
+	blocks, err := r.read(int64(blocksSize))
+	if err != nil {
+		return err
+	}
+	type key struct {
+		text   string
+		offset int64
+	}
+	var keys []key
+	for _, size := range blockSizes {
+		if size < 0 || size > int64(len(blocks)) {
+			return errors.New("truncated key blocks")
+		}
+		b, err := decompress(blocks[:size])
+		if err != nil {
+			return fmt.Errorf("key block: %w", err)
+		}
+		blocks = blocks[size:]
+
+		for len(b) > 0 {
+			if len(b) < w.number {
+				return errors.New("truncated key block")
+			}
+			offset := readUint(b, w.number)
+			b = b[w.number:]
+			end := indexNUL(b, cw)
+			if end < 0 {
+				return errors.New("unterminated key")
+			}
+			text, err := decode(mf.encoding, b[:end])
+			if err != nil {
+				return err
+			}
+			b = b[end+cw:]
+			keys = append(keys, key{text, int64(offset)})
+		}
+	}
+
+	// Records follow each other in the order of their keys, so a record
+	// ends where the next one starts, or with the record blocks.
+	mf.keys = make(map[string][]span, len(keys))
+	for i, k := range keys {
+		end := int64(-1)
+		if i+1 < len(keys) {
+			end = keys[i+1].offset
+		}
+		text := strings.ToLower(strings.TrimSpace(k.text))
+		mf.keys[text] = append(mf.keys[text], span{offset: k.offset, size: end - k.offset})
+	}
+	return nil
+}
+
+// readRecordBlocks reads the sizes of the record blocks, which follow.
+func (mf *file) readRecordBlocks(r *offsetReader, w widths) error {
+	var sizes [4]uint64
+	for i := range sizes {
+		n, err := r.uint(w.number)
+		if err != nil {
+			return err
+		}
+		sizes[i] = n
+	}
+	numBlocks := sizes[0]
+	if numBlocks > uint64(r.size-r.offset)/uint64(2*w.number) {
+		return errors.New("truncated record block info")
+	}
+
+	var (
+		offset     = r.offset + int64(numBlocks)*2*int64(w.number)
+		dataOffset int64
+	)
+	mf.blocks = make([]recordBlock, 0, numBlocks)
+	for range numBlocks {
+		size, err := r.uint(w.number)
+		if err != nil {
+			return err
+		}
+		dataSize, err := r.uint(w.number)
+		if err != nil {
+			return err
+		}
+		if size > uint64(r.size-offset) || dataSize > math.MaxInt64-uint64(dataOffset) {
+			return errors.New("record block beyond the end of the file")
+		}
+		mf.blocks = append(mf.blocks, recordBlock{
+			offset:     offset,
+			size:       int64(size),
+			dataOffset: dataOffset,
+			dataSize:   int64(dataSize),
+		})
+		offset += int64(size)
+		dataOffset += int64(dataSize)
+	}
+
+	// The last record ends with the record blocks.
+	for text, spans := range mf.keys {
+		for i, s := range spans {
+			if s.size < 0 {
+				spans[i].size = dataOffset - s.offset
+			}
+		}
+		mf.keys[text] = spans
+	}
+	return nil
+}
+
+// records returns the records of key, matched regardless of case.
+func (mf *file) records(key string) ([][]byte, error) {
+	spans := mf.keys[strings.ToLower(key)]
+	records := make([][]byte, 0, len(spans))
+	for _, s := range spans {
+		b, err := mf.read(s)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, b)
+	}
+	return records, nil
+}
+
+// read reads the data of s from the record blocks holding it.
+func (mf *file) read(s span) ([]byte, error) {
+	if s.offset < 0 || s.size < 0 {
+		return nil, errors.New("invalid record location")
+	}
+	i := sort.Search(len(mf.blocks), func(i int) bool {
+		b := mf.blocks[i]
+		return b.dataOffset+b.dataSize > s.offset
+	})
+
+	var out []byte
+	for ; i < len(mf.blocks) && int64(len(out)) < s.size; i++ {
+		data, err := mf.block(i)
+		if err != nil {
+			return nil, err
+		}
+		start := max(s.offset-mf.blocks[i].dataOffset, 0)
+		if start > int64(len(data)) {
+			return nil, errors.New("record beyond its record block")
+		}
+		end := start + min(s.size-int64(len(out)), int64(len(data))-start)
+		out = append(out, data[start:end]...)
+	}
+	if int64(len(out)) < s.size {
+		return nil, errors.New("record beyond the record blocks")
+	}
+	return out, nil
+}
+
+// block returns the decompressed i-th record block, caching the last one
+// since the records of a word are often next to each other.
+func (mf *file) block(i int) ([]byte, error) {
+	mf.mu.Lock()
+	defer mf.mu.Unlock()
+	if mf.cache.block == i {
+		return mf.cache.data, nil
+	}
+
+	b := mf.blocks[i]
+	comp := make([]byte, b.size)
+	if _, err := mf.f.ReadAt(comp, b.offset); err != nil {
+		return nil, err
+	}
+	data, err := decompress(comp)
+	if err != nil {
+		return nil, fmt.Errorf("record block: %w", err)
+	}
+	if int64(len(data)) != b.dataSize {
+		return nil, fmt.Errorf("record block of %d bytes, want %d", len(data), b.dataSize)
+	}
+	mf.cache.block, mf.cache.data = i, data
+	return data, nil
+}
+
+// decompress decompresses a block: a 4-byte compression type, a 4-byte
+// checksum, then the data.
+func decompress(b []byte) ([]byte, error) {
+	if len(b) < 8 {
+		return nil, errors.New("truncated block")
+	}
+	switch binary.LittleEndian.Uint32(b) {
+	case 0:
+		return b[8:], nil
+	case 1:
+		return nil, errors.New("LZO compression is not supported")
+	case 2:
+		zr, err := zlib.NewReader(bytes.NewReader(b[8:]))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	}
+	return nil, fmt.Errorf("unknown compression type %d", binary.LittleEndian.Uint32(b))
+}
+
+// decryptKeyInfo decrypts the key block info, whose data is encrypted with
+// a key derived from its checksum.
+func decryptKeyInfo(b []byte) []byte {
+	if len(b) < 8 {
+		return b
+	}
+	key := ripemd128(append(b[4:8:8], 0x95, 0x36, 0, 0))
+	out := bytes.Clone(b)
+	prev := byte(0x36)
+	for i, c := range b[8:] {
+		t := c>>4 | c<<4
+		out[8+i] = t ^ prev ^ byte(i) ^ key[i%len(key)]
+		prev = c
+	}
+	return out
+}
+
+// indexNUL returns the index of the first NUL character of width cw in b,
+// or -1.
+func indexNUL(b []byte, cw int) int {
+	for i := 0; i+cw <= len(b); i += cw {
+		if b[i] == 0 && (cw == 1 || b[i+1] == 0) {
+			return i
+		}
+	}
+	return -1
+}
+
+func readUint(b []byte, n int) uint64 {
+	if n == 8 {
+		return binary.BigEndian.Uint64(b)
+	}
+	return uint64(binary.BigEndian.Uint32(b))
+}
+
+// offsetReader reads big-endian numbers and keeps track of the offset. It
+// refuses to read beyond size, so that corrupt sizes cannot cause huge
+// allocations.
+type offsetReader struct {
+	r      io.Reader
+	offset int64
+	size   int64
+}
+
+func (r *offsetReader) read(n int64) ([]byte, error) {
+	if n < 0 || n > r.size-r.offset {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return nil, err
+	}
+	r.offset += n
+	return b, nil
+}
+
+func (r *offsetReader) uint(n int) (uint64, error) {
+	b, err := r.read(int64(n))
+	if err != nil {
+		return 0, err
+	}
+	if n == 1 {
+		return uint64(b[0]), nil
+	}
+	if n == 2 {
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	}
+	return readUint(b, n), nil
+}
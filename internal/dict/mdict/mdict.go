@@ -0,0 +1,226 @@
+// Package mdict implements a dictionary reading MDict files: the .mdx file
+// of definitions, and the .mdd files of resources such as audio files.
+package mdict
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/lftk/anki-vocab/internal/dict"
+)
+
+type Config struct {
+	// Path is the .mdx file. Resources are read from the .mdd files of the
+	// same name next to it, e.g. "oald.mdd", "oald.1.mdd" and so on.
+	Path string `yaml:"path"`
+
+	// Accents maps accents to regular expressions matching the names of
+	// their audio files, e.g. {"uk": "(?i)_gb_|/bre/", "us": "(?i)_us_|/ame/"}.
+	// If empty, the first audio file of a definition is used for "us".
+	Accents map[string]string `yaml:"accents"`
+
+	// AudioFormat is the format of the audio files, e.g. "mp3". If empty, it
+	// is the most common format in the .mdd files.
+	AudioFormat string `yaml:"audio_format"`
+
+	// Exact disables the lookup of the base forms of words that are not
+	// keys of the .mdx file, e.g. of "ran" under "run", for dictionaries
+	// whose @@@LINK entries already redirect inflections to headwords.
+	Exact bool `yaml:"exact"`
+}
+
+func New(cfg *Config) (*dict.Dict, error) {
+	mdx, err := openFile(cfg.Path, false)
+	if err != nil {
+		return nil, err
+	}
+	d := &Dict{mdx: mdx, exact: cfg.Exact}
+
+	base := strings.TrimSuffix(cfg.Path, ".mdx")
+	for i := 0; ; i++ {
+		name := base + ".mdd"
+		if i > 0 {
+			name = fmt.Sprintf("%s.%d.mdd", base, i)
+		}
+		mdd, err := openFile(name, true)
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		d.mdds = append(d.mdds, mdd)
+	}
+
+	d.accents = make(map[string]*regexp.Regexp, len(cfg.Accents))
+	for accent, expr := range cfg.Accents {
+		if d.accents[accent], err = regexp.Compile(expr); err != nil {
+			return nil, fmt.Errorf("accent %s: %w", accent, err)
+		}
+	}
+	accents := slices.Sorted(maps.Keys(d.accents))
+	if len(accents) == 0 {
+		accents = []string{dict.DefaultAccent}
+	}
+
+	caps := &dict.Capabilities{
+		Query: &dict.QueryCapabilities{},
+	}
+	if format := cmp.Or(cfg.AudioFormat, d.audioFormat()); format != "" {
+		caps.Pronounce = &dict.PronounceCapabilities{
+			Accents: accents,
+			Formats: []string{format},
+		}
+		caps.Media = []dict.MediaKind{dict.MediaAudio}
+	}
+	return &dict.Dict{Queryer: d, Pronouncer: d, Capabilities: caps}, nil
+}
+
+type Dict struct {
+	mdx     *file
+	mdds    []*file
+	accents map[string]*regexp.Regexp
+	exact   bool
+}
+
+// maxLinks limits the chains of "@@@LINK=" redirections between entries.
+const maxLinks = 5
+
+// lookup returns the definitions of word, or of its lower case or base
+// form, and the headword found.
+func (d *Dict) lookup(word string) (string, []string, error) {
+	for _, w := range dict.Headwords(word, d.exact) {
+		defs, err := d.definitions(w, maxLinks)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(defs) > 0 {
+			return w, defs, nil
+		}
+	}
+	return "", nil, fmt.Errorf("%q: %w", word, dict.ErrNotFound)
+}
+
+// definitions returns the definitions of key, following redirections.
+func (d *Dict) definitions(key string, links int) ([]string, error) {
+	records, err := d.mdx.records(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var defs []string
+	for _, rec := range records {
+		def, err := decode(d.mdx.encoding, rec)
+		if err != nil {
+			return nil, err
+		}
+		def = strings.TrimRight(def, "\x00\r\n ")
+		if target, ok := strings.CutPrefix(def, "@@@LINK="); ok {
+			if links == 0 {
+				continue
+			}
+			linked, err := d.definitions(strings.TrimSpace(target), links-1)
+			if err != nil {
+				return nil, err
+			}
+			defs = append(defs, linked...)
+			continue
+		}
+		defs = append(defs, def)
+	}
+	return defs, nil
+}
+
+// Query returns the definitions of word as a JSON object with the word
+// found and the HTML of the definitions, e.g. {"word": "run", "html": "..."}.
+// The audio files that the definitions link to are listed under "sounds".
+func (d *Dict) Query(ctx context.Context, word string) ([]byte, error) {
+	headword, defs, err := d.lookup(word)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]any{
+		"word": headword,
+		"html": strings.Join(defs, "\n"),
+	}
+	var sounds []string
+	for _, def := range defs {
+		sounds = append(sounds, dict.SoundLinks(def)...)
+	}
+	if len(sounds) > 0 {
+		result["sounds"] = sounds
+	}
+	return json.Marshal(result)
+}
+
+// Pronounce returns the first audio file in format that the definitions of
+// word link to with "sound://", and whose name matches the accent.
+func (d *Dict) Pronounce(ctx context.Context, word, accent, format string) (io.ReadCloser, error) {
+	_, defs, err := d.lookup(word)
+	if err != nil {
+		return nil, err
+	}
+
+	re := d.accents[accent]
+	for _, def := range defs {
+		for _, name := range dict.SoundLinks(def) {
+			if !strings.EqualFold(strings.TrimPrefix(path.Ext(name), "."), format) {
+				continue
+			}
+			if re != nil && !re.MatchString(name) {
+				continue
+			}
+			b, err := d.resource(name)
+			if errors.Is(err, dict.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			return io.NopCloser(bytes.NewReader(b)), nil
+		}
+	}
+	return nil, fmt.Errorf("audio of %q: %w", word, dict.ErrNotFound)
+}
+
+// resource returns the resource name from the .mdd files.
+func (d *Dict) resource(name string) ([]byte, error) {
+	// Keys of resources are paths with backslashes, e.g. "\us\run.mp3".
+	key := `\` + strings.TrimLeft(strings.ReplaceAll(name, "/", `\`), `\`)
+	for _, mdd := range d.mdds {
+		records, err := mdd.records(key)
+		if err != nil {
+			return nil, err
+		}
+		if len(records) > 0 {
+			return records[0], nil
+		}
+	}
+	return nil, fmt.Errorf("resource %q: %w", name, dict.ErrNotFound)
+}
+
+// audioFormat returns the most common format of the audio files of the
+// .mdd files, or "" if there are none.
+func (d *Dict) audioFormat() string {
+	return dict.AudioFormat(func(yield func(string) bool) {
+		for _, mdd := range d.mdds {
+			for key := range mdd.keys {
+				if !yield(key) {
+					return
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,377 @@
+package mdict
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/adler32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/lftk/anki-vocab/internal/dict"
+)
+
+// testFile describes an MDict file for writeFile.
+type testFile struct {
+	version   string      // GeneratedByEngineVersion: "2.0", or "1.2" for version 1.
+	encoding  string      // Of keys and records. MDD files use UTF-16 regardless.
+	encrypted string      // The Encrypted attribute, "2" to encrypt the key block info.
+	mdd       bool        // Whether records are resources rather than text.
+	entries   [][2]string // Keys and their records, in order.
+
+	// Corrupt sizes, for testing corrupt files.
+	keyBlockSize  uint64 // Replaces the size of the first key block.
+	recordPadding int    // Is added to the declared sizes of record blocks.
+}
+
+// writeFile writes f to path, with two entries per key and record block.
+func writeFile(t *testing.T, path string, f *testFile) []byte {
+	t.Helper()
+	w := widths{number: 8, text: 2, term: 1}
+	if f.version < "2" {
+		w = widths{number: 4, text: 1, term: 0}
+	}
+	// Unsupported encodings are written as UTF-8.
+	enc, _ := textEncoding(f.encoding)
+	if f.mdd {
+		enc = utf16
+	}
+	encode := func(s string) []byte {
+		if enc == nil {
+			return []byte(s)
+		}
+		b, err := enc.NewEncoder().Bytes([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	cw := 1
+	if enc == utf16 {
+		cw = 2
+	}
+	nul := make([]byte, cw)
+	number := func(b []byte, n int) []byte {
+		if w.number == 8 {
+			return binary.BigEndian.AppendUint64(b, uint64(n))
+		}
+		return binary.BigEndian.AppendUint32(b, uint32(n))
+	}
+	text := func(b []byte, s string) []byte {
+		n := len([]rune(s))
+		if w.text == 2 {
+			b = binary.BigEndian.AppendUint16(b, uint16(n))
+		} else {
+			b = append(b, byte(n))
+		}
+		b = append(b, encode(s)...)
+		if w.term == 1 {
+			b = append(b, nul...)
+		}
+		return b
+	}
+
+	var (
+		info, keyBlocks    []byte
+		recordInfo, blocks []byte
+		offset             int
+	)
+	for group := range slices.Chunk(f.entries, 2) {
+		var keys, records []byte
+		for _, e := range group {
+			keys = number(keys, offset+len(records))
+			keys = append(keys, encode(e[0])...)
+			keys = append(keys, nul...)
+			if f.mdd {
+				records = append(records, e[1]...)
+			} else {
+				records = append(records, encode(e[1])...)
+			}
+		}
+		offset += len(records)
+
+		block := compress(keys)
+		info = number(info, len(group))
+		info = text(info, group[0][0])
+		info = text(info, group[len(group)-1][0])
+		if f.keyBlockSize != 0 && len(keyBlocks) == 0 {
+			info = binary.BigEndian.AppendUint64(info, f.keyBlockSize)
+		} else {
+			info = number(info, len(block))
+		}
+		info = number(info, len(keys))
+		keyBlocks = append(keyBlocks, block...)
+
+		block = compress(records)
+		recordInfo = number(recordInfo, len(block))
+		recordInfo = number(recordInfo, len(records)+f.recordPadding)
+		blocks = append(blocks, block...)
+	}
+	numBlocks := (len(f.entries) + 1) / 2
+
+	header := encode(fmt.Sprintf(`<Dictionary GeneratedByEngineVersion="%s" Encrypted="%s" Encoding="%s" Title="Test"/>`,
+		f.version, f.encrypted, f.encoding))
+	if enc != utf16 {
+		header, _ = utf16.NewEncoder().Bytes(header)
+	}
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(header)))
+	b = append(b, header...)
+	b = binary.LittleEndian.AppendUint32(b, adler32.Checksum(header))
+
+	b = number(b, numBlocks)
+	b = number(b, len(f.entries))
+	if w.number == 8 {
+		infoLen := len(info)
+		info = compress(info)
+		if f.encrypted == "2" {
+			info = encryptKeyInfo(info)
+		}
+		b = number(b, infoLen)
+		b = number(b, len(info))
+		b = number(b, len(keyBlocks))
+		b = binary.BigEndian.AppendUint32(b, 0) // Checksum of the sizes.
+	} else {
+		b = number(b, len(info))
+		b = number(b, len(keyBlocks))
+	}
+	b = append(b, info...)
+	b = append(b, keyBlocks...)
+
+	b = number(b, numBlocks)
+	b = number(b, len(f.entries))
+	b = number(b, len(recordInfo))
+	b = number(b, len(blocks))
+	b = append(b, recordInfo...)
+	b = append(b, blocks...)
+
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// compress compresses a block with zlib.
+func compress(b []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{2, 0, 0, 0})
+	buf.Write(binary.BigEndian.AppendUint32(nil, adler32.Checksum(b)))
+	zw := zlib.NewWriter(&buf)
+	zw.Write(b)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// encryptKeyInfo is the inverse of decryptKeyInfo.
+func encryptKeyInfo(b []byte) []byte {
+	key := ripemd128(append(b[4:8:8], 0x95, 0x36, 0, 0))
+	out := bytes.Clone(b)
+	prev := byte(0x36)
+	for i, c := range b[8:] {
+		t := c ^ prev ^ byte(i) ^ key[i%len(key)]
+		out[8+i] = t>>4 | t<<4
+		prev = out[8+i]
+	}
+	return out
+}
+
+var (
+	testEntries = [][2]string{
+		{"apple", "<b>n.</b> 苹果\x00"},
+		{"colour", "@@@LINK=color\r\n\x00"},
+		{"color", "<b>n.</b> 颜色\x00"},
+		{"Run", `<b>v.</b> 跑 <a href="sound://us/run.mp3">▶</a> <a href="sound://uk/run.mp3">▶</a>` + "\x00"},
+	}
+	testResources = [][2]string{
+		{`\run.png`, "PNG run"},
+		{`\uk\run.mp3`, "ID3 uk run"},
+		{`\us\run.mp3`, "ID3 us run"},
+	}
+)
+
+// writeDict writes the test dictionary, with its resources split into two
+// MDD files, and returns the path of the MDX file.
+func writeDict(t *testing.T, version, encoding, encrypted string) string {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "words.mdx")
+	writeFile(t, path, &testFile{
+		version:   version,
+		encoding:  encoding,
+		encrypted: encrypted,
+		entries:   testEntries,
+	})
+	for i, entries := range [][][2]string{testResources[:1], testResources[1:]} {
+		name := "words.mdd"
+		if i > 0 {
+			name = fmt.Sprintf("words.%d.mdd", i)
+		}
+		writeFile(t, filepath.Join(dir, name), &testFile{
+			version:   version,
+			encrypted: encrypted,
+			mdd:       true,
+			entries:   entries,
+		})
+	}
+	return path
+}
+
+func TestQuery(t *testing.T) {
+	tests := []struct {
+		word string
+		want map[string]any // Nil if the word is not found.
+	}{
+		{"run", map[string]any{
+			"word":   "run",
+			"html":   `<b>v.</b> 跑 <a href="sound://us/run.mp3">▶</a> <a href="sound://uk/run.mp3">▶</a>`,
+			"sounds": []any{"us/run.mp3", "uk/run.mp3"},
+		}},
+		{"Apple", map[string]any{"word": "Apple", "html": "<b>n.</b> 苹果"}},
+		{"running", map[string]any{"word": "run"}},
+		{"colour", map[string]any{"word": "colour", "html": "<b>n.</b> 颜色"}},
+		{"pear", nil},
+	}
+	dicts := []struct {
+		version, encoding, encrypted string
+	}{
+		{"2.0", "UTF-8", "2"},
+		{"2.0", "GBK", "0"},
+		{"1.2", "UTF-16", ""},
+	}
+	for _, dt := range dicts {
+		name := fmt.Sprintf("version %s in %s", dt.version, dt.encoding)
+		d, err := New(&Config{Path: writeDict(t, dt.version, dt.encoding, dt.encrypted)})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, tt := range tests {
+			b, err := d.Queryer.Query(context.Background(), tt.word)
+			if tt.want == nil {
+				if !errors.Is(err, dict.ErrNotFound) {
+					t.Errorf("%s: Query(%q) = %s, %v, want %v", name, tt.word, b, err, dict.ErrNotFound)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: Query(%q): %v", name, tt.word, err)
+				continue
+			}
+			var got map[string]any
+			if err = json.Unmarshal(b, &got); err != nil {
+				t.Fatalf("%s: Query(%q) = %s: %v", name, tt.word, b, err)
+			}
+			for key, want := range tt.want {
+				if fmt.Sprint(got[key]) != fmt.Sprint(want) {
+					t.Errorf("%s: Query(%q)[%q] = %v, want %v", name, tt.word, key, got[key], want)
+				}
+			}
+		}
+	}
+}
+
+func TestPronounce(t *testing.T) {
+	path := writeDict(t, "2.0", "UTF-8", "0")
+	pronounce := func(d *dict.Dict, word, accent string) (string, error) {
+		r, err := d.Pronouncer.Pronounce(context.Background(), word, accent, "mp3")
+		if err != nil {
+			return "", err
+		}
+		defer r.Close()
+		b, err := io.ReadAll(r)
+		return string(b), err
+	}
+
+	d, err := New(&Config{Path: path, Accents: map[string]string{"uk": "^uk/", "us": "^us/"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caps := d.Capabilities.Pronounce
+	if caps == nil || !slices.Equal(caps.Accents, []string{"uk", "us"}) || !slices.Equal(caps.Formats, []string{"mp3"}) {
+		t.Fatalf("pronounce capabilities = %+v, want uk and us accents in mp3", caps)
+	}
+	for accent, want := range map[string]string{"uk": "ID3 uk run", "us": "ID3 us run"} {
+		if got, err := pronounce(d, "ran", accent); err != nil || got != want {
+			t.Errorf("Pronounce(%q, %q) = %q, %v, want %q", "ran", accent, got, err, want)
+		}
+	}
+	if _, err = pronounce(d, "apple", "us"); !errors.Is(err, dict.ErrNotFound) {
+		t.Errorf("Pronounce(%q): err = %v, want %v", "apple", err, dict.ErrNotFound)
+	}
+
+	// Without accents, the first audio file is used for us.
+	if d, err = New(&Config{Path: path}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := pronounce(d, "run", "us"); err != nil || got != "ID3 us run" {
+		t.Errorf("Pronounce(%q) = %q, %v, want the first audio file", "run", got, err)
+	}
+}
+
+func TestOpenFileInvalid(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "words.mdx")
+	b := writeFile(t, path, &testFile{version: "2.0", encoding: "UTF-8", entries: testEntries})
+
+	// Every truncation must fail rather than panic or allocate the sizes
+	// it reads.
+	for n := range len(b) {
+		if err := os.WriteFile(path, b[:n], 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := openFile(path, false); err == nil {
+			t.Fatalf("openFile succeeded on %d of %d bytes", n, len(b))
+		}
+	}
+
+	for _, f := range []*testFile{
+		{version: "3.0", encoding: "UTF-8", entries: testEntries},
+		{version: "2.0", encoding: "UTF-8", encrypted: "1", entries: testEntries},
+		{version: "2.0", encoding: "EUC-KR", entries: testEntries},
+	} {
+		writeFile(t, path, f)
+		if _, err := openFile(path, false); err == nil {
+			t.Errorf("openFile succeeded on %+v", f)
+		}
+	}
+
+	// Key blocks larger than the key section, or than any file.
+	for _, size := range []uint64{1 << 20, 1 << 63, 1<<64 - 1} {
+		writeFile(t, path, &testFile{version: "2.0", encoding: "UTF-8", entries: testEntries, keyBlockSize: size})
+		if _, err := openFile(path, false); err == nil {
+			t.Errorf("openFile succeeded with a key block of %d bytes", size)
+		}
+	}
+}
+
+func TestQueryCorruptRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.mdx")
+	for _, padding := range []int{-4, 16} {
+		writeFile(t, path, &testFile{version: "2.0", encoding: "UTF-8", entries: testEntries, recordPadding: padding})
+		d, err := New(&Config{Path: path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = d.Queryer.Query(context.Background(), "run"); err == nil || errors.Is(err, dict.ErrNotFound) {
+			t.Errorf("Query with record blocks %d bytes off: err = %v, want a corrupt file error", padding, err)
+		}
+	}
+
+	// A record located beyond its block, as if the block were shorter.
+	mf := &file{
+		keys:   map[string][]span{"run": {{offset: 8, size: 4}}},
+		blocks: []recordBlock{{dataSize: 16}},
+	}
+	mf.cache.block, mf.cache.data = 0, []byte("run\x00")
+	for _, s := range []span{{offset: 8, size: 4}, {offset: -1, size: 4}, {offset: 0, size: -1}} {
+		mf.keys["run"] = []span{s}
+		if _, err := mf.records("run"); err == nil {
+			t.Errorf("records of %+v succeeded, want an error", s)
+		}
+	}
+}
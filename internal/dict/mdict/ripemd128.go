@@ -0,0 +1,87 @@
+package mdict
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// ripemd128 returns the RIPEMD-128 digest of b, which MDict uses to derive
+// the key encrypting the key block index.
+func ripemd128(b []byte) [16]byte {
+	h := [4]uint32{0x67452301, 0xefcdab89, 0x98badcfe, 0x10325476}
+
+	// Padding as in MD4: a 1 bit, zeros, then the length in bits.
+	msg := append([]byte(nil), b...)
+	msg = append(msg, 0x80)
+	for len(msg)%64 != 56 {
+		msg = append(msg, 0)
+	}
+	msg = binary.LittleEndian.AppendUint64(msg, uint64(len(b))*8)
+
+	var x [16]uint32
+	for ; len(msg) > 0; msg = msg[64:] {
+		for i := range x {
+			x[i] = binary.LittleEndian.Uint32(msg[4*i:])
+		}
+
+		al, bl, cl, dl := h[0], h[1], h[2], h[3]
+		ar, br, cr, dr := h[0], h[1], h[2], h[3]
+		for j := range 64 {
+			round := j / 16
+			t := al + rmdF(round, bl, cl, dl) + x[rmdR[j]] + rmdK[round]
+			al, dl, cl, bl = dl, cl, bl, bits.RotateLeft32(t, int(rmdS[j]))
+
+			t = ar + rmdF(3-round, br, cr, dr) + x[rmdRR[j]] + rmdKK[round]
+			ar, dr, cr, br = dr, cr, br, bits.RotateLeft32(t, int(rmdSS[j]))
+		}
+		h[0], h[1], h[2], h[3] = h[1]+cl+dr, h[2]+dl+ar, h[3]+al+br, h[0]+bl+cr
+	}
+
+	var sum [16]byte
+	for i, v := range h {
+		binary.LittleEndian.PutUint32(sum[4*i:], v)
+	}
+	return sum
+}
+
+func rmdF(round int, x, y, z uint32) uint32 {
+	switch round {
+	case 0:
+		return x ^ y ^ z
+	case 1:
+		return x&y | ^x&z
+	case 2:
+		return (x | ^y) ^ z
+	}
+	return x&z | y&^z
+}
+
+var (
+	rmdK  = [4]uint32{0x00000000, 0x5a827999, 0x6ed9eba1, 0x8f1bbcdc}
+	rmdKK = [4]uint32{0x50a28be6, 0x5c4dd124, 0x6d703ef3, 0x00000000}
+
+	rmdR = [64]uint8{
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		7, 4, 13, 1, 10, 6, 15, 3, 12, 0, 9, 5, 2, 14, 11, 8,
+		3, 10, 14, 4, 9, 15, 8, 1, 2, 7, 0, 6, 13, 11, 5, 12,
+		1, 9, 11, 10, 0, 8, 12, 4, 13, 3, 7, 15, 14, 5, 6, 2,
+	}
+	rmdRR = [64]uint8{
+		5, 14, 7, 0, 9, 2, 11, 4, 13, 6, 15, 8, 1, 10, 3, 12,
+		6, 11, 3, 7, 0, 13, 5, 10, 14, 15, 8, 12, 4, 9, 1, 2,
+		15, 5, 1, 3, 7, 14, 6, 9, 11, 8, 12, 2, 10, 0, 4, 13,
+		8, 6, 4, 1, 3, 11, 15, 0, 5, 12, 2, 13, 9, 7, 10, 14,
+	}
+	rmdS = [64]uint8{
+		11, 14, 15, 12, 5, 8, 7, 9, 11, 13, 14, 15, 6, 7, 9, 8,
+		7, 6, 8, 13, 11, 9, 7, 15, 7, 12, 15, 9, 11, 7, 13, 12,
+		11, 13, 6, 7, 14, 9, 13, 15, 14, 8, 13, 6, 5, 12, 7, 5,
+		11, 12, 14, 15, 14, 15, 9, 8, 9, 14, 5, 6, 8, 6, 5, 12,
+	}
+	rmdSS = [64]uint8{
+		8, 9, 9, 11, 13, 15, 15, 5, 7, 7, 8, 11, 14, 14, 12, 6,
+		9, 13, 15, 7, 12, 8, 9, 11, 7, 7, 12, 7, 6, 15, 13, 11,
+		9, 7, 15, 11, 8, 6, 6, 14, 12, 13, 5, 14, 13, 13, 7, 5,
+		15, 5, 8, 11, 14, 14, 6, 14, 6, 9, 12, 9, 12, 5, 15, 8,
+	}
+)
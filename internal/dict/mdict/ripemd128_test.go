@@ -0,0 +1,30 @@
+package mdict
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// The test vectors of the RIPEMD-128 specification.
+func TestRipemd128(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", "cdf26213a150dc3ecb610f18f6b38b46"},
+		{"a", "86be7afa339d0fc7cfc785e72f578d33"},
+		{"abc", "c14a12199c66e4ba84636b0f69144c77"},
+		{"message digest", "9e327b3d6e523062afc1132d7df9d1b8"},
+		{"abcdefghijklmnopqrstuvwxyz", "fd2aa607f71dc8f510714922b371834e"},
+		{"abcdbcdecdefdefgefghfghighijhijkijkljklmklmnlmnomnopnopq", "a1aa0689d0fafa2ddc22e88b49133a06"},
+		{"ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789", "d1e959eb179c911faea4624c60c5c702"},
+		{strings.Repeat("1234567890", 8), "3f45ef194732c2dbb2c4a2c769795fa3"},
+		{strings.Repeat("a", 1000000), "4a7f5723f954eba1216c9d8f6320431f"},
+	}
+	for _, tt := range tests {
+		sum := ripemd128([]byte(tt.in))
+		if got := hex.EncodeToString(sum[:]); got != tt.want {
+			t.Errorf("ripemd128(%.20q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
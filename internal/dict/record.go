@@ -0,0 +1,199 @@
+package dict
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ErrNotRecorded is returned when replaying a query or pronunciation that
+// was never recorded.
+var ErrNotRecorded = errors.New("not recorded")
+
+// Recordings are laid out like the cache: the result of a query is stored
+// in <word>.json and a pronunciation in <word>_<accent>.<format>, with a
+// hash instead of words unfit for file names, see resultKey and audioFile.
+// That a dictionary found nothing is stored as an empty file named after
+// the result with notFoundExt appended.
+const notFoundExt = ".notfound"
+
+type recordingQueryer struct {
+	dir string
+	Queryer
+}
+
+// RecordingQueryer returns a queryer that queries q and stores each result
+// in dir, where ReplayQueryer finds it later.
+func RecordingQueryer(dir string, q Queryer) Queryer {
+	return &recordingQueryer{dir: dir, Queryer: q}
+}
+
+func (q *recordingQueryer) Query(ctx context.Context, word string) ([]byte, error) {
+	key, err := resultKey(ctx, q.Queryer, word)
+	if err != nil {
+		return nil, err
+	}
+	b, err := q.Queryer.Query(ctx, word)
+	if err = record(filepath.Join(q.dir, key+".json"), b, err); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// QueryBatch queries words at once if the underlying dictionary is a
+// BatchQueryer, storing the results.
+func (q *recordingQueryer) QueryBatch(ctx context.Context, words []string) (map[string][]byte, error) {
+	bq, ok := q.Queryer.(BatchQueryer)
+	if !ok {
+		return nil, nil
+	}
+	results, err := bq.QueryBatch(ctx, words)
+	if err != nil {
+		return nil, err
+	}
+	for word, b := range results {
+		key, err := resultKey(ctx, q.Queryer, word)
+		if err != nil {
+			return nil, err
+		}
+		if err = record(filepath.Join(q.dir, key+".json"), b, nil); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+func (q *recordingQueryer) Variant(ctx context.Context, word string) (string, error) {
+	return variant(ctx, q.Queryer, word)
+}
+
+// record stores at path the result b of a query, or that it found nothing
+// if err is ErrNotFound. Any other error is returned as is.
+func record(path string, b []byte, err error) error {
+	switch {
+	case err == nil:
+		if err = os.WriteFile(path, b, 0644); err != nil {
+			return err
+		}
+		return removeIfExists(path + notFoundExt)
+	case errors.Is(err, ErrNotFound):
+		if werr := os.WriteFile(path+notFoundExt, nil, 0644); werr != nil {
+			return werr
+		}
+		return errors.Join(err, removeIfExists(path))
+	}
+	return err
+}
+
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+type replayQueryer struct {
+	dir string
+	q   Queryer
+}
+
+// ReplayQueryer returns a queryer that returns the results recorded in dir
+// by a RecordingQueryer. It never queries q, which only tells apart the
+// variants of its results, and may be nil. A result recorded for the word
+// alone is returned for any hints or variant not recorded.
+func ReplayQueryer(dir string, q Queryer) Queryer {
+	return &replayQueryer{dir: dir, q: q}
+}
+
+func (q *replayQueryer) Query(ctx context.Context, word string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	key, err := resultKey(ctx, q.q, word)
+	if err != nil {
+		return nil, err
+	}
+	b, err := replay(filepath.Join(q.dir, key+".json"))
+	if plain := fileKey(word); errors.Is(err, ErrNotRecorded) && key != plain {
+		b, err = replay(filepath.Join(q.dir, plain+".json"))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", word, err)
+	}
+	return b, nil
+}
+
+// replay reads the result recorded at path.
+func replay(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return b, err
+	}
+	if _, err = os.Stat(path + notFoundExt); err == nil {
+		return nil, ErrNotFound
+	}
+	return nil, fmt.Errorf("%w in %s", ErrNotRecorded, filepath.Dir(path))
+}
+
+type recordingPronouncer struct {
+	dir string
+	Pronouncer
+}
+
+// RecordingPronouncer returns a pronouncer that pronounces with p and
+// stores each pronunciation in dir, where ReplayPronouncer finds it later.
+func RecordingPronouncer(dir string, p Pronouncer) Pronouncer {
+	return &recordingPronouncer{dir: dir, Pronouncer: p}
+}
+
+func (rp *recordingPronouncer) Pronounce(ctx context.Context, word, accent, format string) (io.ReadCloser, error) {
+	path := filepath.Join(rp.dir, audioFile(word, accent, format))
+	audio, err := rp.Pronouncer.Pronounce(ctx, word, accent, format)
+	if err != nil {
+		return nil, record(path, nil, err)
+	}
+	w, err := os.CreateTemp(rp.dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		_ = audio.Close()
+		return nil, err
+	}
+	if err = removeIfExists(path + notFoundExt); err != nil {
+		_ = audio.Close()
+		return nil, errors.Join(err, w.Close(), os.Remove(w.Name()))
+	}
+	return &teeReadCloser{r: audio, w: w, path: path}, nil
+}
+
+type replayPronouncer struct {
+	dir string
+}
+
+// ReplayPronouncer returns a pronouncer that returns the pronunciations
+// recorded in dir by a RecordingPronouncer.
+func ReplayPronouncer(dir string) Pronouncer {
+	return &replayPronouncer{dir: dir}
+}
+
+func (rp *replayPronouncer) Pronounce(ctx context.Context, word, accent, format string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(rp.dir, audioFile(word, accent, format))
+	f, err := os.Open(path)
+	switch {
+	case err == nil:
+		return f, nil
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+	if _, err = os.Stat(path + notFoundExt); err == nil {
+		return nil, fmt.Errorf("%q: %w", word, ErrNotFound)
+	}
+	return nil, fmt.Errorf("%q in %s accent: %w in %s", word, accent, ErrNotRecorded, rp.dir)
+}
@@ -0,0 +1,180 @@
+package stardict
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+// dictzip reads a file compressed with dictzip, a gzip file whose extra
+// field holds the sizes of chunks that can be inflated independently, so
+// that reading part of the file only requires inflating its chunks.
+type dictzip struct {
+	f        *os.File
+	chunkLen int64
+	offsets  []int64 // Of the chunks in the file, followed by the end.
+}
+
+// sizeReaderAt is an io.ReaderAt of known size.
+type sizeReaderAt interface {
+	io.ReaderAt
+	Size() int64
+}
+
+// openDictzip opens the dictzip file path. Gzip files without the chunk
+// sizes are inflated in memory once.
+func openDictzip(path string) (sizeReaderAt, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	dz, err := readDictzipHeader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if dz != nil {
+		return dz, nil
+	}
+	defer f.Close()
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(b), nil
+}
+
+// readDictzipHeader parses the gzip header of f, returning nil if it has no
+// dictzip chunk sizes.
+func readDictzipHeader(f *os.File) (*dictzip, error) {
+	r := bufio.NewReader(f)
+	var hdr [10]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	if hdr[0] != 0x1f || hdr[1] != 0x8b || hdr[2] != 8 {
+		return nil, errors.New("not a gzip file")
+	}
+	const (
+		fhcrc    = 1 << 1
+		fextra   = 1 << 2
+		fname    = 1 << 3
+		fcomment = 1 << 4
+	)
+	flags, size := hdr[3], int64(len(hdr))
+
+	var dz *dictzip
+	if flags&fextra != 0 {
+		var n [2]byte
+		if _, err := io.ReadFull(r, n[:]); err != nil {
+			return nil, err
+		}
+		extra := make([]byte, binary.LittleEndian.Uint16(n[:]))
+		if _, err := io.ReadFull(r, extra); err != nil {
+			return nil, err
+		}
+		size += 2 + int64(len(extra))
+
+		for len(extra) >= 4 {
+			id, n := string(extra[:2]), int(binary.LittleEndian.Uint16(extra[2:]))
+			data := extra[4:min(4+n, len(extra))]
+			extra = extra[len(data)+4:]
+			// Version, chunk length, chunk count, then the chunk sizes.
+			if id != "RA" || len(data) < 6 || binary.LittleEndian.Uint16(data) != 1 {
+				continue
+			}
+			count := int(binary.LittleEndian.Uint16(data[4:]))
+			if len(data) < 6+2*count {
+				return nil, errors.New("truncated dictzip chunk table")
+			}
+			chunkLen := int64(binary.LittleEndian.Uint16(data[2:]))
+			if chunkLen == 0 {
+				return nil, errors.New("invalid dictzip chunk length 0")
+			}
+			dz = &dictzip{f: f, chunkLen: chunkLen}
+			dz.offsets = make([]int64, count+1)
+			for i := range count {
+				dz.offsets[i+1] = dz.offsets[i] + int64(binary.LittleEndian.Uint16(data[6+2*i:]))
+			}
+		}
+	}
+	for _, flag := range []byte{fname, fcomment} {
+		if flags&flag == 0 {
+			continue
+		}
+		s, err := r.ReadBytes(0)
+		if err != nil {
+			return nil, err
+		}
+		size += int64(len(s))
+	}
+	if flags&fhcrc != 0 {
+		size += 2
+	}
+
+	if dz != nil {
+		for i := range dz.offsets {
+			dz.offsets[i] += size
+		}
+	}
+	return dz, nil
+}
+
+func (dz *dictzip) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		i := int(pos / dz.chunkLen)
+		if i >= len(dz.offsets)-1 {
+			return n, io.EOF
+		}
+		chunk, err := dz.chunk(i)
+		if err != nil {
+			return n, err
+		}
+		start := pos - int64(i)*dz.chunkLen
+		if start >= int64(len(chunk)) {
+			return n, io.EOF
+		}
+		n += copy(p[n:], chunk[start:])
+	}
+	return n, nil
+}
+
+// Size returns the size of the inflated file, or more if the last chunk is
+// shorter than the others.
+func (dz *dictzip) Size() int64 {
+	return dz.chunkLen * int64(len(dz.offsets)-1)
+}
+
+func (dz *dictzip) Close() error {
+	return dz.f.Close()
+}
+
+// chunk inflates the i-th chunk.
+func (dz *dictzip) chunk(i int) ([]byte, error) {
+	start, end := dz.offsets[i], dz.offsets[i+1]
+	fr := flate.NewReader(io.NewSectionReader(dz.f, start, end-start))
+	defer fr.Close()
+
+	b := make([]byte, dz.chunkLen)
+	n, err := io.ReadFull(fr, b)
+	// Chunks end with a flush rather than the end of the stream.
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		err = nil
+	}
+	return b[:n], err
+}
@@ -0,0 +1,94 @@
+package stardict
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDictzip(t *testing.T) {
+	want, err := os.ReadFile("testdata/plain/words.dict")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := openDictzip("testdata/compressed/words.dict.dz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dz, ok := r.(*dictzip)
+	if !ok {
+		t.Fatalf("openDictzip returned %T, want the chunks of a dictzip file", r)
+	}
+	defer dz.Close()
+	if len(dz.offsets) < 3 {
+		t.Fatalf("%d chunks, want several", len(dz.offsets)-1)
+	}
+	if dz.Size() < int64(len(want)) {
+		t.Errorf("Size = %d, want at least %d", dz.Size(), len(want))
+	}
+
+	// Read every span, within and across chunks.
+	for off := range len(want) {
+		for n := 1; off+n <= len(want); n++ {
+			p := make([]byte, n)
+			if _, err := dz.ReadAt(p, int64(off)); err != nil {
+				t.Fatalf("ReadAt(%d bytes, %d): %v", n, off, err)
+			}
+			if !bytes.Equal(p, want[off:off+n]) {
+				t.Fatalf("ReadAt(%d bytes, %d) = %q, want %q", n, off, p, want[off:off+n])
+			}
+		}
+	}
+	if _, err := dz.ReadAt(make([]byte, 2), int64(len(want))-1); err != io.EOF {
+		t.Errorf("ReadAt past the end: err = %v, want EOF", err)
+	}
+}
+
+func TestDictzipGzip(t *testing.T) {
+	want, err := os.ReadFile("testdata/plain/words.idx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := openDictzip("testdata/compressed/words.idx.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, want) {
+		t.Errorf("inflated %q, want %q", b, want)
+	}
+}
+
+func TestDictzipInvalid(t *testing.T) {
+	// A gzip header whose RA extra field has a chunk length of 0.
+	ra := binary.LittleEndian.AppendUint16(nil, 1) // Version.
+	ra = binary.LittleEndian.AppendUint16(ra, 0)   // Chunk length.
+	ra = binary.LittleEndian.AppendUint16(ra, 0)   // Chunk count.
+	extra := binary.LittleEndian.AppendUint16([]byte("RA"), uint16(len(ra)))
+	extra = append(extra, ra...)
+	zeroChunks := []byte{0x1f, 0x8b, 8, 1 << 2, 0, 0, 0, 0, 0, 3}
+	zeroChunks = binary.LittleEndian.AppendUint16(zeroChunks, uint16(len(extra)))
+	zeroChunks = append(zeroChunks, extra...)
+
+	tests := map[string][]byte{
+		"empty":       nil,
+		"not gzip":    []byte("StarDict's dict ifo file\n"),
+		"zero chunks": zeroChunks,
+		"truncated":   zeroChunks[:14],
+	}
+	for name, b := range tests {
+		path := filepath.Join(t.TempDir(), "words.dict.dz")
+		if err := os.WriteFile(path, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := openDictzip(path); err == nil {
+			t.Errorf("%s: openDictzip succeeded, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package stardict
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+
+	"github.com/lftk/anki-vocab/internal/dict"
+)
+
+// field is a part of a definition, whose type tells what the data is, e.g.
+// 'h' for HTML or 'W' for WAV audio.
+type field struct {
+	typ  byte
+	data []byte
+}
+
+// typeNames names the types of text fields in query results.
+var typeNames = map[byte]string{
+	'm': "text",
+	'l': "text",
+	'g': "pango",
+	't': "phonetic",
+	'x': "xdxf",
+	'y': "yinbiao",
+	'k': "kingsoft",
+	'w': "wiki",
+	'h': "html",
+	'n': "wordnet",
+}
+
+func isText(typ byte) bool {
+	_, ok := typeNames[typ]
+	return ok
+}
+
+// parseFields splits the data of a definition into its fields. If types,
+// the sametypesequence of the dictionary, is empty, each field starts with
+// its type. Fields of lower case types are text ending with a NUL byte,
+// those of upper case types binary data starting with their size. The last
+// field of a sametypesequence has neither.
+func parseFields(b []byte, types string) ([]field, error) {
+	var fields []field
+	next := func(typ byte, last bool) error {
+		var data []byte
+		switch {
+		case last:
+			data, b = b, nil
+		case typ >= 'a' && typ <= 'z':
+			i := bytes.IndexByte(b, 0)
+			if i < 0 {
+				// Tolerate a missing NUL byte at the end.
+				i = len(b)
+			}
+			data, b = b[:i], b[min(i+1, len(b)):]
+		default:
+			if len(b) < 4 {
+				return errors.New("truncated field")
+			}
+			n := int(binary.BigEndian.Uint32(b))
+			if len(b) < 4+n {
+				return errors.New("truncated field")
+			}
+			data, b = b[4:4+n], b[4+n:]
+		}
+		fields = append(fields, field{typ: typ, data: data})
+		return nil
+	}
+
+	if types != "" {
+		for i := range len(types) {
+			if err := next(types[i], i == len(types)-1); err != nil {
+				return nil, err
+			}
+		}
+		return fields, nil
+	}
+	for len(b) > 0 {
+		typ := b[0]
+		b = b[1:]
+		if err := next(typ, false); err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// audioFiles returns the audio files of the res directory that a field
+// refers to.
+func audioFiles(f field) []string {
+	var files []string
+	switch {
+	case f.typ == 'r':
+		for _, res := range strings.Split(string(f.data), "\n") {
+			if kind, name, ok := strings.Cut(strings.TrimSpace(res), ":"); ok && kind == "snd" {
+				files = append(files, name)
+			}
+		}
+	case f.typ == 'h':
+		files = append(files, dict.SoundLinks(string(f.data))...)
+	}
+	return files
+}
@@ -0,0 +1,318 @@
+// Package stardict implements a dictionary reading StarDict files: the .ifo
+// file, the .idx word index, optionally compressed with gzip, the .dict
+// definitions, optionally compressed with dictzip, and optionally the .syn
+// synonyms and the res directory of resources such as audio files.
+package stardict
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lftk/anki-vocab/internal/dict"
+)
+
+type Config struct {
+	// Path is the .ifo file of the dictionary, next to its other files.
+	Path string `yaml:"path"`
+
+	// Accent is the accent of the audio of the dictionary, "us" by default.
+	Accent string `yaml:"accent"`
+
+	// AudioFormat is the format of the audio of the dictionary, e.g. "mp3".
+	// If empty, it is "wav" for audio embedded in definitions, or the most
+	// common format in the res directory.
+	AudioFormat string `yaml:"audio_format"`
+
+	// Exact disables the lookup of the base forms of words missing from the
+	// .idx and .syn files, e.g. of "ran" under "run", for dictionaries whose
+	// synonyms already list the inflections of their headwords.
+	Exact bool `yaml:"exact"`
+}
+
+func New(cfg *Config) (*dict.Dict, error) {
+	info, err := readInfo(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+	base := strings.TrimSuffix(cfg.Path, filepath.Ext(cfg.Path))
+
+	d := &Dict{
+		types:  info["sametypesequence"],
+		resDir: filepath.Join(filepath.Dir(cfg.Path), "res"),
+		exact:  cfg.Exact,
+	}
+	var size int64
+	if d.data, size, err = openData(base); err != nil {
+		return nil, err
+	}
+	if d.index, d.entries, err = readIndex(base, info["idxoffsetbits"] == "64", size); err != nil {
+		return nil, err
+	}
+
+	caps := &dict.Capabilities{
+		Query: &dict.QueryCapabilities{},
+	}
+	if format := cmp.Or(cfg.AudioFormat, d.audioFormat()); format != "" {
+		caps.Pronounce = &dict.PronounceCapabilities{
+			Accents: []string{cmp.Or(cfg.Accent, dict.DefaultAccent)},
+			Formats: []string{format},
+		}
+		caps.Media = []dict.MediaKind{dict.MediaAudio}
+	}
+	return &dict.Dict{Queryer: d, Pronouncer: d, Capabilities: caps}, nil
+}
+
+// readInfo reads the key=value lines of the .ifo file.
+func readInfo(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	if !s.Scan() || strings.TrimSpace(s.Text()) != "StarDict's dict ifo file" {
+		return nil, fmt.Errorf("%s: not a StarDict .ifo file", path)
+	}
+	info := make(map[string]string)
+	for s.Scan() {
+		if key, val, ok := strings.Cut(s.Text(), "="); ok {
+			info[strings.TrimSpace(key)] = strings.TrimSpace(val)
+		}
+	}
+	return info, s.Err()
+}
+
+// entry locates the data of a definition in the .dict file.
+type entry struct {
+	word   string
+	offset int64
+	size   int64
+}
+
+// readIndex reads the .idx file, and the .syn file if any, returning the
+// entries of each word and synonym. The definitions of the entries must lie
+// within the first dataSize bytes of the .dict file.
+func readIndex(base string, offset64 bool, dataSize int64) (map[string][]int, []entry, error) {
+	b, err := readMaybeGzip(base+".idx", base+".idx.gz")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	offsetLen := 4
+	if offset64 {
+		offsetLen = 8
+	}
+	var (
+		index   = make(map[string][]int)
+		entries []entry
+	)
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, 0)
+		if i < 0 || len(b) < i+1+offsetLen+4 {
+			return nil, nil, fmt.Errorf("%s.idx: truncated entry", base)
+		}
+		e := entry{word: string(b[:i])}
+		b = b[i+1:]
+		if offset64 {
+			e.offset = int64(binary.BigEndian.Uint64(b))
+		} else {
+			e.offset = int64(binary.BigEndian.Uint32(b))
+		}
+		e.size = int64(binary.BigEndian.Uint32(b[offsetLen:]))
+		b = b[offsetLen+4:]
+		if e.offset < 0 || e.offset > dataSize || e.size > dataSize-e.offset {
+			return nil, nil, fmt.Errorf("%s.idx: definition of %q beyond the end of the .dict file", base, e.word)
+		}
+
+		index[e.word] = append(index[e.word], len(entries))
+		entries = append(entries, e)
+	}
+
+	b, err = readMaybeGzip(base+".syn", base+".syn.dz")
+	if errors.Is(err, os.ErrNotExist) {
+		return index, entries, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, 0)
+		if i < 0 || len(b) < i+5 {
+			return nil, nil, fmt.Errorf("%s.syn: truncated entry", base)
+		}
+		word, n := string(b[:i]), int(binary.BigEndian.Uint32(b[i+1:]))
+		b = b[i+5:]
+		if n < len(entries) {
+			index[word] = append(index[word], n)
+		}
+	}
+	return index, entries, nil
+}
+
+// readMaybeGzip reads the file path, or else its compressed version gzPath.
+func readMaybeGzip(path, gzPath string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if !errors.Is(err, os.ErrNotExist) {
+		return b, err
+	}
+	r, err := openDictzip(gzPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%s: %w", path, os.ErrNotExist)
+		}
+		return nil, fmt.Errorf("%s: %w", gzPath, err)
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+	return io.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+}
+
+// openData opens the .dict file, or else the .dict.dz file, returning the
+// size of the definitions it holds.
+func openData(base string) (io.ReaderAt, int64, error) {
+	f, err := os.Open(base + ".dict")
+	if err == nil {
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+		return f, fi.Size(), nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, 0, err
+	}
+	r, err := openDictzip(base + ".dict.dz")
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s.dict.dz: %w", base, err)
+	}
+	return r, r.Size(), nil
+}
+
+type Dict struct {
+	index   map[string][]int // Entries by word.
+	entries []entry
+	data    io.ReaderAt
+	types   string // The sametypesequence of the .ifo file.
+	resDir  string
+	exact   bool
+}
+
+// lookup returns the fields of the definitions of word, or of its lower
+// case or base form, and the headword of the first definition.
+func (d *Dict) lookup(word string) (string, []field, error) {
+	for _, w := range dict.Headwords(word, d.exact) {
+		ids, ok := d.index[w]
+		if !ok {
+			continue
+		}
+		var fields []field
+		for _, id := range ids {
+			e := d.entries[id]
+			b := make([]byte, e.size)
+			if _, err := d.data.ReadAt(b, e.offset); err != nil {
+				return "", nil, fmt.Errorf("definition of %q: %w", e.word, err)
+			}
+			fs, err := parseFields(b, d.types)
+			if err != nil {
+				return "", nil, fmt.Errorf("definition of %q: %w", e.word, err)
+			}
+			fields = append(fields, fs...)
+		}
+		return d.entries[ids[0]].word, fields, nil
+	}
+	return "", nil, fmt.Errorf("%q: %w", word, dict.ErrNotFound)
+}
+
+// Query returns the definitions of word as a JSON object with the word
+// found and the text of each type of field, such as "html" or "phonetic",
+// e.g. {"word": "run", "phonetic": "rʌn", "html": "<b>v.</b> 跑"}.
+// Resources such as images and audio are listed under "resources".
+func (d *Dict) Query(ctx context.Context, word string) ([]byte, error) {
+	headword, fields, err := d.lookup(word)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]any{"word": headword}
+	var resources []string
+	for _, f := range fields {
+		switch {
+		case f.typ == 'r':
+			for _, res := range strings.Split(string(f.data), "\n") {
+				if _, name, ok := strings.Cut(strings.TrimSpace(res), ":"); ok {
+					resources = append(resources, name)
+				}
+			}
+		case isText(f.typ):
+			name := typeNames[f.typ]
+			if prev, ok := result[name].(string); ok {
+				result[name] = prev + "\n" + string(f.data)
+			} else {
+				result[name] = string(f.data)
+			}
+		}
+	}
+	if len(resources) > 0 {
+		result["resources"] = resources
+	}
+	return json.Marshal(result)
+}
+
+// Pronounce returns the first audio of the definitions of word in format:
+// WAV audio embedded in the definition, or an audio file of the res
+// directory, listed as a resource or linked to with "sound://".
+func (d *Dict) Pronounce(ctx context.Context, word, accent, format string) (io.ReadCloser, error) {
+	_, fields, err := d.lookup(word)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range fields {
+		if f.typ == 'W' && format == "wav" {
+			return io.NopCloser(bytes.NewReader(f.data)), nil
+		}
+		for _, name := range audioFiles(f) {
+			name = filepath.FromSlash(name)
+			if !filepath.IsLocal(name) {
+				// Definitions must not reach outside the res directory.
+				continue
+			}
+			if strings.EqualFold(strings.TrimPrefix(filepath.Ext(name), "."), format) {
+				return os.Open(filepath.Join(d.resDir, name))
+			}
+		}
+	}
+	return nil, fmt.Errorf("audio of %q: %w", word, dict.ErrNotFound)
+}
+
+// audioFormat guesses the format of the audio of the dictionary, or returns
+// "" if it has none.
+func (d *Dict) audioFormat() string {
+	if strings.ContainsRune(d.types, 'W') {
+		return "wav"
+	}
+	files, err := os.ReadDir(d.resDir)
+	if err != nil {
+		return ""
+	}
+	return dict.AudioFormat(func(yield func(string) bool) {
+		for _, f := range files {
+			if !yield(f.Name()) {
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,163 @@
+package stardict
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lftk/anki-vocab/internal/dict"
+)
+
+// The dictionaries of testdata hold apple, color and run, with colour as a
+// synonym of color, in plain files and compressed with gzip and dictzip.
+var testDicts = []string{"testdata/plain/words.ifo", "testdata/compressed/words.ifo"}
+
+func TestQuery(t *testing.T) {
+	tests := []struct {
+		word string
+		want map[string]string // Nil if the word is not found.
+	}{
+		{"run", map[string]string{
+			"word":     "run",
+			"phonetic": "rʌn",
+			"html":     `<b>v.</b> 跑 <a href="sound://run.mp3">▶</a>`,
+		}},
+		{"Apple", map[string]string{"word": "apple", "phonetic": "ˈæpl", "html": "<b>n.</b> 苹果"}},
+		{"running", map[string]string{"word": "run"}},
+		{"colour", map[string]string{"word": "color", "html": "<b>n.</b> 颜色"}},
+		{"pear", nil},
+	}
+	for _, path := range testDicts {
+		d, err := New(&Config{Path: path})
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		for _, tt := range tests {
+			b, err := d.Queryer.Query(context.Background(), tt.word)
+			if tt.want == nil {
+				if !errors.Is(err, dict.ErrNotFound) {
+					t.Errorf("%s: Query(%q) = %s, %v, want %v", path, tt.word, b, err, dict.ErrNotFound)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: Query(%q): %v", path, tt.word, err)
+				continue
+			}
+			var got map[string]any
+			if err = json.Unmarshal(b, &got); err != nil {
+				t.Fatalf("%s: Query(%q) = %s: %v", path, tt.word, b, err)
+			}
+			for key, want := range tt.want {
+				if got[key] != want {
+					t.Errorf("%s: Query(%q)[%q] = %v, want %q", path, tt.word, key, got[key], want)
+				}
+			}
+		}
+	}
+}
+
+func TestQueryExact(t *testing.T) {
+	d, err := New(&Config{Path: testDicts[0], Exact: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Queryer.Query(context.Background(), "running"); !errors.Is(err, dict.ErrNotFound) {
+		t.Errorf("Query(%q): err = %v, want %v", "running", err, dict.ErrNotFound)
+	}
+}
+
+func TestPronounce(t *testing.T) {
+	d, err := New(&Config{Path: testDicts[0], Accent: "uk"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caps := d.Capabilities.Pronounce
+	if caps == nil || caps.Accents[0] != "uk" || caps.Formats[0] != "mp3" {
+		t.Fatalf("pronounce capabilities = %+v, want uk accent in mp3", caps)
+	}
+
+	r, err := d.Pronouncer.Pronounce(context.Background(), "ran", "uk", "mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := os.ReadFile("testdata/plain/res/run.mp3"); string(b) != string(want) {
+		t.Errorf("Pronounce(%q) = %q, want res/run.mp3", "ran", b)
+	}
+
+	for _, word := range []string{"apple", "pear"} {
+		if _, err = d.Pronouncer.Pronounce(context.Background(), word, "uk", "mp3"); !errors.Is(err, dict.ErrNotFound) {
+			t.Errorf("Pronounce(%q): err = %v, want %v", word, err, dict.ErrNotFound)
+		}
+	}
+}
+
+// copyDict copies the plain dictionary of testdata to a temporary directory.
+func copyDict(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range []string{"words.ifo", "words.idx", "words.dict"} {
+		b, err := os.ReadFile(filepath.Join("testdata/plain", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(filepath.Join(dir, name), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "words.ifo")
+}
+
+func TestNewInvalidIndex(t *testing.T) {
+	path := copyDict(t)
+	idx := filepath.Join(filepath.Dir(path), "words.idx")
+	b, err := os.ReadFile(idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The size of the definition of apple, after "apple\0" and its offset.
+	binary.BigEndian.PutUint32(b[10:], 1<<31)
+	if err = os.WriteFile(idx, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = New(&Config{Path: path}); err == nil {
+		t.Error("New succeeded with a definition beyond the end of the .dict file")
+	}
+
+	if err = os.WriteFile(idx, b[:len(b)-2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = New(&Config{Path: path}); err == nil {
+		t.Error("New succeeded with a truncated .idx file")
+	}
+}
+
+func TestPronounceOutsideRes(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "secret.mp3"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	def := []byte(`<a href="sound://../secret.mp3">▶</a>`)
+	d := &Dict{
+		index:   map[string][]int{"run": {0}},
+		entries: []entry{{word: "run", size: int64(len(def))}},
+		data:    bytes.NewReader(def),
+		types:   "h",
+		resDir:  filepath.Join(dir, "res"),
+	}
+	if _, err := d.Pronounce(context.Background(), "run", "us", "mp3"); !errors.Is(err, dict.ErrNotFound) {
+		t.Errorf("Pronounce of a link outside the res directory: err = %v, want %v", err, dict.ErrNotFound)
+	}
+}
@@ -0,0 +1,125 @@
+package dict
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sync"
+)
+
+// ErrBudgetExceeded is returned by AI dictionaries once the token budget of
+// the run is used up.
+var ErrBudgetExceeded = errors.New("token budget exceeded")
+
+// Usage is the number of tokens used by AI requests.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+func (u Usage) TotalTokens() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+func (u Usage) add(v Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + v.PromptTokens,
+		CompletionTokens: u.CompletionTokens + v.CompletionTokens,
+	}
+}
+
+// Stats collects what happened while querying dictionaries during a run,
+// for reporting at its end. A nil *Stats discards everything.
+type Stats struct {
+	mu       sync.Mutex
+	parent   *Stats
+	budget   int
+	repaired []string
+	usage    map[string]Usage // By dictionary.
+}
+
+// NewStats returns stats that limit the tokens used by AI dictionaries to
+// budget, or not at all if budget is zero.
+func NewStats(budget int) *Stats {
+	return &Stats{budget: budget}
+}
+
+// child returns stats that also record into s.
+func (s *Stats) child() *Stats {
+	return &Stats{parent: s}
+}
+
+type statsKey struct{}
+
+// WithStats returns a copy of ctx that records into s.
+func WithStats(ctx context.Context, s *Stats) context.Context {
+	return context.WithValue(ctx, statsKey{}, s)
+}
+
+// StatsFrom returns the stats that ctx records into, or nil.
+func StatsFrom(ctx context.Context) *Stats {
+	s, _ := ctx.Value(statsKey{}).(*Stats)
+	return s
+}
+
+// AddRepaired records that the AI response for word did not match the
+// expected schema at first and had to be repaired.
+func (s *Stats) AddRepaired(word string) {
+	for ; s != nil; s = s.parent {
+		s.mu.Lock()
+		s.repaired = append(s.repaired, word)
+		s.mu.Unlock()
+	}
+}
+
+// Repaired returns the words whose AI responses had to be repaired.
+func (s *Stats) Repaired() []string {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.repaired...)
+}
+
+// AddUsage records the tokens used by a request to the named dictionary.
+func (s *Stats) AddUsage(name string, u Usage) {
+	for ; s != nil; s = s.parent {
+		s.mu.Lock()
+		if s.usage == nil {
+			s.usage = make(map[string]Usage)
+		}
+		s.usage[name] = s.usage[name].add(u)
+		s.mu.Unlock()
+	}
+}
+
+// Usage returns the tokens used by each dictionary.
+func (s *Stats) Usage() map[string]Usage {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.usage)
+}
+
+// TotalUsage returns the tokens used by all dictionaries.
+func (s *Stats) TotalUsage() Usage {
+	var total Usage
+	for _, u := range s.Usage() {
+		total = total.add(u)
+	}
+	return total
+}
+
+// CheckBudget returns ErrBudgetExceeded if the token budget is used up.
+// AI dictionaries call it before each request.
+func (s *Stats) CheckBudget() error {
+	for ; s != nil; s = s.parent {
+		if s.budget > 0 && s.TotalUsage().TotalTokens() >= s.budget {
+			return ErrBudgetExceeded
+		}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+// Package tts implements a pronouncer that synthesizes speech with a
+// locally installed engine, such as espeak-ng or piper, so that any word
+// or sentence can be pronounced offline.
+package tts
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/lftk/anki-vocab/internal/audio"
+	"github.com/lftk/anki-vocab/internal/dict"
+	"github.com/lftk/anki-vocab/internal/tmplinspect"
+	"github.com/lftk/anki-vocab/internal/utils"
+)
+
+type Config struct {
+	// Command is the command line synthesizing speech. Its arguments are
+	// templates of the text to speak {{.text}}, the voice of the accent
+	// {{.voice}} and the file to write the audio to {{.output}}, e.g.
+	// ["espeak-ng", "-v", "{{.voice}}", "-w", "{{.output}}", "{{.text}}"].
+	// If no argument refers to {{.output}}, the audio is read from the
+	// standard output of the command.
+	Command []string `yaml:"command"`
+
+	// Stdin writes the text to the standard input of the command.
+	Stdin bool `yaml:"stdin"`
+
+	// Voices maps accents to voices, e.g. {"us": "en-us", "uk": "en-gb"}.
+	// If empty, the command has a single voice, used for "us".
+	Voices map[string]string `yaml:"voices"`
+
+	// Format is the format of the audio produced by the command, "wav" by
+	// default. WAV and MP3 audio is converted to the other format if
+	// needed, see audio.Process; audio in other formats is used as is.
+	Format string `yaml:"format"`
+
+	// Timeout limits the run time of the command, 30 seconds by default.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+const (
+	defaultFormat  = "wav"
+	defaultTimeout = 30 * time.Second
+)
+
+func New(cfg *Config) (*dict.Dict, error) {
+	if len(cfg.Command) == 0 {
+		return nil, errors.New("command is required")
+	}
+
+	d := &Dict{
+		voices:  cfg.Voices,
+		stdin:   cfg.Stdin,
+		format:  cmp.Or(cfg.Format, defaultFormat),
+		timeout: cmp.Or(cfg.Timeout, defaultTimeout),
+	}
+	for i, arg := range cfg.Command {
+		fields, _, err := tmplinspect.Inspect(arg)
+		if err != nil {
+			return nil, fmt.Errorf("command argument %d: %w", i, err)
+		}
+		if slices.Contains(fields, "output") {
+			d.output = true
+		}
+		tmpl, err := template.New(fmt.Sprint(i)).Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return nil, fmt.Errorf("command argument %d: %w", i, err)
+		}
+		d.args = append(d.args, tmpl)
+	}
+
+	// Only the formats that audio.Process decodes can be converted.
+	formats := []string{d.format}
+	if d.format == "mp3" || d.format == "wav" {
+		formats = utils.SliceUnique([]string{d.format, "mp3", "wav"})
+	}
+
+	accents := slices.Sorted(maps.Keys(cfg.Voices))
+	if len(accents) == 0 {
+		accents = []string{dict.DefaultAccent}
+	}
+	caps := &dict.Capabilities{
+		Pronounce: &dict.PronounceCapabilities{
+			Accents:   accents,
+			Formats:   formats,
+			Sentences: true,
+		},
+		Media: []dict.MediaKind{dict.MediaAudio},
+	}
+	return &dict.Dict{Pronouncer: d, Capabilities: caps}, nil
+}
+
+type Dict struct {
+	args    []*template.Template
+	output  bool // Whether the command writes to {{.output}}.
+	stdin   bool
+	voices  map[string]string
+	format  string
+	timeout time.Duration
+}
+
+// Pronounce runs the command to speak word, which can be any text, with the
+// voice of accent, converting the audio to format if needed.
+func (d *Dict) Pronounce(ctx context.Context, word, accent, format string) (io.ReadCloser, error) {
+	voice, ok := d.voices[accent]
+	if !ok && len(d.voices) > 0 {
+		return nil, fmt.Errorf("no voice for %q accent", accent)
+	}
+
+	data := map[string]string{"text": word, "voice": voice}
+	if d.output {
+		f, err := os.CreateTemp("", "anki-vocab-tts-*."+d.format)
+		if err != nil {
+			return nil, err
+		}
+		f.Close()
+		defer os.Remove(f.Name())
+		data["output"] = f.Name()
+	}
+
+	args := make([]string, len(d.args))
+	for i, tmpl := range d.args {
+		var b strings.Builder
+		if err := tmpl.Execute(&b, data); err != nil {
+			return nil, err
+		}
+		args[i] = b.String()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	if d.stdin {
+		cmd.Stdin = strings.NewReader(word)
+	}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Processes started by the command, e.g. by a shell script, may keep
+	// its output open after it is killed.
+	cmd.WaitDelay = time.Second
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%s: timed out after %s", args[0], d.timeout)
+		}
+		if msg := bytes.TrimSpace(stderr.Bytes()); len(msg) > 0 {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, fmt.Errorf("%s: %w", args[0], err)
+	}
+
+	b := stdout.Bytes()
+	if d.output {
+		var err error
+		if b, err = os.ReadFile(data["output"]); err != nil {
+			return nil, err
+		}
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("%s: no audio", args[0])
+	}
+
+	if format != d.format {
+		var err error
+		b, _, err = audio.Process(ctx, b, d.format, &audio.Config{Format: format})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
@@ -0,0 +1,152 @@
+package tts
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// script writes a shell script running body and returns its path.
+func script(t *testing.T, body string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell")
+	}
+	path := filepath.Join(t.TempDir(), "tts.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func pronounce(t *testing.T, cfg *Config, word, accent string) (string, error) {
+	t.Helper()
+	d, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := d.Pronouncer.Pronounce(context.Background(), word, accent, d.Capabilities.Pronounce.Formats[0])
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	return string(b), err
+}
+
+func TestPronounce(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *Config
+		want string
+	}{
+		{
+			name: "output file",
+			cfg: &Config{Command: []string{
+				script(t, `printf 'audio of %s' "$1" > "$2"`), "{{.text}}", "{{.output}}",
+			}},
+			want: "audio of give up",
+		},
+		{
+			name: "stdout",
+			cfg:  &Config{Command: []string{script(t, `printf 'audio of %s' "$1"`), "{{.text}}"}},
+			want: "audio of give up",
+		},
+		{
+			name: "stdin",
+			cfg:  &Config{Command: []string{script(t, `printf 'audio of '; cat`)}, Stdin: true},
+			want: "audio of give up",
+		},
+	}
+	for _, tt := range tests {
+		got, err := pronounce(t, tt.cfg, "give up", "us")
+		if err != nil || got != tt.want {
+			t.Errorf("%s: Pronounce = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestPronounceVoices(t *testing.T) {
+	cfg := &Config{
+		Command: []string{script(t, `printf '%s' "$1"`), "{{.voice}}"},
+		Voices:  map[string]string{"us": "en-us", "uk": "en-gb"},
+	}
+	d, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.Capabilities.Pronounce.Accents; !slices.Equal(got, []string{"uk", "us"}) {
+		t.Errorf("accents = %q, want uk and us", got)
+	}
+	for accent, want := range cfg.Voices {
+		if got, err := pronounce(t, cfg, "run", accent); err != nil || got != want {
+			t.Errorf("Pronounce in %s accent = %q, %v, want voice %q", accent, got, err, want)
+		}
+	}
+	if _, err := pronounce(t, cfg, "run", "au"); err == nil || !strings.Contains(err.Error(), "no voice") {
+		t.Errorf("Pronounce in au accent: err = %v, want no voice", err)
+	}
+
+	// A command without voices speaks the default accent, with no voice.
+	cfg = &Config{Command: []string{script(t, `printf '[%s]' "$1"`), "{{.voice}}"}}
+	if got, err := pronounce(t, cfg, "run", "us"); err != nil || got != "[]" {
+		t.Errorf("Pronounce without voices = %q, %v, want an empty voice", got, err)
+	}
+}
+
+func TestPronounceErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *Config
+		want string
+	}{
+		{"timeout", &Config{Command: []string{script(t, "sleep 10")}, Timeout: 100 * time.Millisecond}, "timed out"},
+		{"empty output", &Config{Command: []string{script(t, "true")}}, "no audio"},
+		{"empty output file", &Config{Command: []string{script(t, "true"), "{{.output}}"}}, "no audio"},
+		{"failure", &Config{Command: []string{script(t, "echo oops >&2; exit 1")}}, "oops"},
+	}
+	for _, tt := range tests {
+		start := time.Now()
+		_, err := pronounce(t, tt.cfg, "run", "us")
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Errorf("%s: took %s", tt.name, time.Since(start))
+		}
+	}
+}
+
+func TestFormats(t *testing.T) {
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{"", []string{"wav", "mp3"}},
+		{"mp3", []string{"mp3", "wav"}},
+		{"ogg", []string{"ogg"}},
+	}
+	for _, tt := range tests {
+		d, err := New(&Config{Command: []string{"espeak-ng"}, Format: tt.format})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := d.Capabilities.Pronounce.Formats; !slices.Equal(got, tt.want) {
+			t.Errorf("formats of %q audio = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	for _, cmd := range [][]string{nil, {"espeak-ng", "{{.text"}} {
+		if _, err := New(&Config{Command: cmd}); err == nil {
+			t.Errorf("New(%q) succeeded, want an error", cmd)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package volcengine
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/lftk/anki-vocab/internal/dict"
+	"github.com/lftk/anki-vocab/internal/jsonschema"
+	"github.com/lftk/anki-vocab/internal/tmplinspect"
+	"github.com/lftk/anki-vocab/internal/utils"
+)
+
+// entryFields are the top-level fields of the prompt data describing the
+// word. Any other field is the result of the dictionary of that name.
+var entryFields = []string{"word", "tags", "deck", "hints"}
+
+// promptTemplate is a system prompt, executed with the word, its wordlist
+// entry and the results of the dictionaries it refers to, as in
+// "{{.word}}", "{{.deck}}" or "{{.youdao.ec.word.trs}}".
+type promptTemplate struct {
+	tmpl   *template.Template
+	schema *jsonschema.Schema // Nil if responses are not validated.
+
+	requires []string // Dictionaries whose results the prompt uses.
+	entry    bool     // Whether the prompt uses the wordlist entry.
+}
+
+func parsePrompt(name, text string) (*promptTemplate, error) {
+	fields, _, err := tmplinspect.Inspect(text)
+	if err != nil {
+		return nil, fmt.Errorf("prompt %s: %w", name, err)
+	}
+
+	tmpl, err := template.New(name).Funcs(template.FuncMap{
+		// Older prompts refer to the word as {{word}}.
+		"word": func() string { return "" },
+	}).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("prompt %s: %w", name, err)
+	}
+
+	p := &promptTemplate{tmpl: tmpl, schema: exampleSchema(text)}
+	for _, f := range fields {
+		root, _, _ := strings.Cut(f, ".")
+		switch {
+		case root == "word":
+		case slices.Contains(entryFields, root):
+			p.entry = true
+		default:
+			p.requires = append(p.requires, root)
+		}
+	}
+	p.requires = utils.SliceUnique(p.requires)
+	return p, nil
+}
+
+// contextual reports whether the prompt depends on more than the word.
+func (p *promptTemplate) contextual() bool {
+	return p.entry || len(p.requires) > 0
+}
+
+func (p *promptTemplate) execute(ctx context.Context, word string) (string, error) {
+	data := map[string]any{
+		"word":  word,
+		"tags":  []string(nil),
+		"deck":  "",
+		"hints": map[string]string(nil),
+	}
+	if e := dict.EntryFrom(ctx); e != nil {
+		data["tags"] = e.Tags
+		data["deck"] = e.Deck
+		data["hints"] = e.Hints
+	}
+	results := dict.Results(ctx)
+	for _, name := range p.requires {
+		data[name] = results[name]
+	}
+
+	tmpl, err := p.tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	tmpl.Funcs(template.FuncMap{
+		"word": func() string { return word },
+	})
+
+	var b strings.Builder
+	if err = tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// selectPrompt returns the prompt for the deck: the one configured for the
+// deck or its closest parent deck, or the default prompt.
+func (d *Dict) selectPrompt(deck string) *promptTemplate {
+	var (
+		best    *promptTemplate
+		bestLen = -1
+	)
+	for name, p := range d.deckPrompts {
+		if (deck == name || strings.HasPrefix(deck, name+"::")) && len(name) > bestLen {
+			best, bestLen = p, len(name)
+		}
+	}
+	if best != nil {
+		return best
+	}
+	return d.prompt
+}
+
+// promptFor returns the prompt for the deck of the word being queried.
+func (d *Dict) promptFor(ctx context.Context) *promptTemplate {
+	var deck string
+	if e := dict.EntryFrom(ctx); e != nil {
+		deck = e.Deck
+	}
+	return d.selectPrompt(deck)
+}
+
+// Variant implements dict.Varianter: results obtained with a prompt for a
+// deck, with a prompt using more than the word, or with the results of
+// other dictionaries, get their own cache entries.
+func (d *Dict) Variant(ctx context.Context, word string) (string, error) {
+	p := d.promptFor(ctx)
+	if p == d.prompt && !p.contextual() && len(d.dependsOn) == 0 {
+		return "", nil
+	}
+	system, err := p.execute(ctx, word)
+	if err != nil {
+		return "", err
+	}
+	upstream, err := d.upstreamContent(ctx)
+	if err != nil {
+		return "", err
+	}
+	return system + upstream, nil
+}
+
+// contextual reports whether the request for a word depends on more than
+// the word itself.
+func (d *Dict) contextual() bool {
+	if len(d.deckPrompts) > 0 || len(d.dependsOn) > 0 {
+		return true
+	}
+	return d.prompt.contextual()
+}
+
+// requires returns the dictionaries whose results the prompts use or that
+// d depends on.
+func (d *Dict) requires() []string {
+	requires := slices.Concat(d.prompt.requires, d.dependsOn)
+	for _, p := range d.deckPrompts {
+		requires = append(requires, p.requires...)
+	}
+	requires = utils.SliceUnique(requires)
+	slices.Sort(requires)
+	return requires
+}
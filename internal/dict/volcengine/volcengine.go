@@ -4,12 +4,21 @@ import (
 	"cmp"
 	"context"
 	_ "embed"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/volcengine/volcengine-go-sdk/service/arkruntime"
 	"github.com/volcengine/volcengine-go-sdk/service/arkruntime/model"
 
 	"github.com/lftk/anki-vocab/internal/dict"
+	"github.com/lftk/anki-vocab/internal/httpclient"
+	"github.com/lftk/anki-vocab/internal/jsonschema"
+	"github.com/lftk/anki-vocab/internal/utils"
 )
 
 //go:embed prompt.txt
@@ -19,54 +28,217 @@ type Config struct {
 	APIKey string `yaml:"api_key"`
 	Model  string `yaml:"model"`
 	Prompt string `yaml:"prompt"`
+
+	// DeckPrompts are the prompts used instead of Prompt for the words of
+	// some decks and their sub-decks, by deck path, e.g. "Unit 1::Reading".
+	DeckPrompts map[string]string `yaml:"deck_prompts"`
+
+	// Schema is the JSON Schema that responses to all prompts must match.
+	// If empty, the schema of each prompt, including the deck prompts, is
+	// inferred from its JSON example.
+	Schema map[string]any `yaml:"schema"`
+
+	// MaxRepairs is how many times the model is asked to correct a
+	// response that does not match the schema, 2 by default. A negative
+	// value disables the repairs.
+	MaxRepairs int `yaml:"max_repairs"`
+
+	// BatchSize is the number of words asked about in a single request,
+	// see Dict.QueryBatch. Zero or one disables batching.
+	BatchSize int `yaml:"batch_size"`
+
+	// DependsOn are the dictionaries whose results are sent to the model
+	// along with the word, e.g. "youdao", so that the content it generates
+	// agrees with their definitions and phonetics.
+	DependsOn []string `yaml:"depends_on"`
+
+	// HTTP configures the client, e.g. its timeout or proxy. Its base_url
+	// replaces https://ark.cn-beijing.volces.com/api/v3.
+	HTTP httpclient.Config `yaml:"http"`
 }
 
-func New(cfg *Config) *dict.Dict {
-	client := arkruntime.NewClientWithApiKey(cfg.APIKey)
+const (
+	defaultMaxRepairs = 2
+
+	// defaultTimeout is that of the SDK, long enough for large responses.
+	defaultTimeout = 10 * time.Minute
+)
+
+// name is the name under which token usage is recorded.
+const name = "volcengine"
+
+func New(cfg *Config) (*dict.Dict, error) {
+	httpClient, err := httpclient.New(&cfg.HTTP, defaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+	opts := []arkruntime.ConfigOption{arkruntime.WithHTTPClient(httpClient)}
+	if cfg.HTTP.BaseURL != "" {
+		opts = append(opts, arkruntime.WithBaseUrl(cfg.HTTP.BaseURL))
+	}
+	client := arkruntime.NewClientWithApiKey(cfg.APIKey, opts...)
 	d := &Dict{
-		client: client,
-		model:  cfg.Model,
-		prompt: cmp.Or(cfg.Prompt, prompt),
+		client:      client,
+		model:       cfg.Model,
+		deckPrompts: make(map[string]*promptTemplate, len(cfg.DeckPrompts)),
+		dependsOn:   utils.SliceUnique(cfg.DependsOn),
+		maxRepairs:  cfg.MaxRepairs,
+	}
+	if d.maxRepairs == 0 {
+		d.maxRepairs = defaultMaxRepairs
+	}
+
+	text := cmp.Or(cfg.Prompt, prompt)
+	if d.prompt, err = parsePrompt("prompt", text); err != nil {
+		return nil, err
+	}
+	for deck, text := range cfg.DeckPrompts {
+		if d.deckPrompts[deck], err = parsePrompt(fmt.Sprintf("for deck %q", deck), text); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Schema != nil {
+		b, err := json.Marshal(cfg.Schema)
+		if err != nil {
+			return nil, err
+		}
+		schema, err := jsonschema.Parse(b)
+		if err != nil {
+			return nil, err
+		}
+		d.prompt.schema = schema
+		for _, p := range d.deckPrompts {
+			p.schema = schema
+		}
 	}
+
 	caps := &dict.Capabilities{
 		Query: &dict.QueryCapabilities{
-			AI: true,
+			AI:       true,
+			Requires: d.requires(),
 		},
 	}
-	return &dict.Dict{Queryer: d, Capabilities: caps}
+	// Batches share a system prompt, which must thus be the same for all
+	// words.
+	if cfg.BatchSize > 1 && !d.contextual() {
+		caps.Query.BatchSize = cfg.BatchSize
+	}
+	return &dict.Dict{Queryer: d, Capabilities: caps}, nil
 }
 
 type Dict struct {
-	client *arkruntime.Client
-	model  string
-	prompt string
+	client      *arkruntime.Client
+	model       string
+	prompt      *promptTemplate
+	deckPrompts map[string]*promptTemplate
+	dependsOn   []string
+	maxRepairs  int
 }
 
+// Query asks the model about word. A response that does not match the
+// schema is sent back to the model along with the violations, for it to
+// correct, at most maxRepairs times.
 func (d *Dict) Query(ctx context.Context, word string) ([]byte, error) {
+	p := d.promptFor(ctx)
+	system, err := p.execute(ctx, word)
+	if err != nil {
+		return nil, err
+	}
+	upstream, err := d.upstreamContent(ctx)
+	if err != nil {
+		return nil, err
+	}
+	messages := []*model.ChatCompletionMessage{
+		message(model.ChatMessageRoleSystem, system),
+		message(model.ChatMessageRoleUser, userContent(word, dict.Hints(ctx))+upstream),
+	}
+	for attempt := 0; ; attempt++ {
+		b, err := d.complete(ctx, messages)
+		if err != nil {
+			return nil, err
+		}
+
+		errs := validate(p.schema, b)
+		if len(errs) == 0 {
+			if attempt > 0 {
+				dict.StatsFrom(ctx).AddRepaired(word)
+			}
+			return b, nil
+		}
+		if attempt >= d.maxRepairs {
+			return nil, fmt.Errorf("response does not match the schema: %w", errors.Join(errs...))
+		}
+
+		messages = append(messages,
+			message(model.ChatMessageRoleAssistant, string(b)),
+			message(model.ChatMessageRoleUser, repairContent(errs)),
+		)
+	}
+}
+
+// QueryBatch asks the model about many words in a single request, sending
+// the system prompt once. Words missing from the response, or whose result
+// does not match the schema, are left out for Query to handle.
+func (d *Dict) QueryBatch(ctx context.Context, words []string) (map[string][]byte, error) {
+	system, err := d.prompt.execute(ctx, batchWord)
+	if err != nil {
+		return nil, err
+	}
+	messages := []*model.ChatCompletionMessage{
+		message(model.ChatMessageRoleSystem, system+batchPrompt),
+		message(model.ChatMessageRoleUser, strings.Join(words, "\n")),
+	}
+	b, err := d.complete(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	var batch map[string]json.RawMessage
+	if err = json.Unmarshal(dict.Unquote(b), &batch); err != nil {
+		return nil, fmt.Errorf("invalid batch response: %w", err)
+	}
+
+	results := make(map[string][]byte, len(words))
+	for _, word := range words {
+		b, ok := batch[word]
+		if !ok || len(validate(d.prompt.schema, b)) > 0 {
+			continue
+		}
+		results[word] = b
+	}
+	return results, nil
+}
+
+// batchWord stands for the word in the system prompt of a batch.
+const batchWord = "（用户消息中的每个单词）"
+
+// batchPrompt is appended to the system prompt when querying many words at
+// once.
+const batchPrompt = `
+
+本次请求包含多个单词：用户消息的每一行是一个单词。请为每个单词分别按上述要求生成内容，并返回一个 JSON 对象，它的键是用户消息中原样的单词，值是该单词按上述格式生成的 JSON 对象。`
+
+func (d *Dict) complete(ctx context.Context, messages []*model.ChatCompletionMessage) ([]byte, error) {
 	req := model.CreateChatCompletionRequest{
-		Model: d.model,
-		Messages: []*model.ChatCompletionMessage{
-			{
-				Role: model.ChatMessageRoleSystem,
-				Content: &model.ChatCompletionMessageContent{
-					StringValue: &d.prompt,
-				},
-			},
-			{
-				Role: model.ChatMessageRoleUser,
-				Content: &model.ChatCompletionMessageContent{
-					StringValue: &word,
-				},
-			},
-		},
+		Model:    d.model,
+		Messages: messages,
 		ResponseFormat: &model.ResponseFormat{
 			Type: model.ResponseFormatJsonObject,
 		},
 	}
+	stats := dict.StatsFrom(ctx)
+	if err := stats.CheckBudget(); err != nil {
+		return nil, err
+	}
 	resp, err := d.client.CreateChatCompletion(ctx, req)
 	if err != nil {
 		return nil, err
 	}
+	stats.AddUsage(name, dict.Usage{
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+	})
 
 	if len(resp.Choices) < 1 {
 		return nil, errors.New("no choices in response")
@@ -79,3 +251,90 @@ func (d *Dict) Query(ctx context.Context, word string) ([]byte, error) {
 
 	return []byte(*val), nil
 }
+
+func message(role, content string) *model.ChatCompletionMessage {
+	return &model.ChatCompletionMessage{
+		Role: role,
+		Content: &model.ChatCompletionMessageContent{
+			StringValue: &content,
+		},
+	}
+}
+
+// validate returns the violations of schema by the response b, if any.
+func validate(schema *jsonschema.Schema, b []byte) []error {
+	if schema == nil {
+		return nil
+	}
+	verrs, err := schema.Validate(dict.Unquote(b))
+	if err != nil {
+		return []error{fmt.Errorf("invalid JSON: %w", err)}
+	}
+	errs := make([]error, 0, len(verrs))
+	for _, err := range verrs {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// repairContent builds the user message asking the model to correct a
+// response with the given violations of the schema.
+func repairContent(errs []error) string {
+	var b strings.Builder
+	b.WriteString("你的回答不符合要求的 JSON 格式，存在以下问题（以 JSON Pointer 表示位置）：\n")
+	for _, err := range errs {
+		fmt.Fprintf(&b, "- %s\n", err)
+	}
+	b.WriteString("请修正这些问题，并重新输出完整的 JSON。")
+	return b.String()
+}
+
+// exampleSchema infers the schema of responses from the first JSON object
+// in the prompt, or returns nil if there is none.
+func exampleSchema(prompt string) *jsonschema.Schema {
+	for i := range len(prompt) {
+		if prompt[i] != '{' {
+			continue
+		}
+		var v map[string]any
+		if err := json.NewDecoder(strings.NewReader(prompt[i:])).Decode(&v); err == nil && len(v) > 0 {
+			return jsonschema.Infer(v)
+		}
+	}
+	return nil
+}
+
+// upstreamContent returns the part of the user message with the results of
+// the dictionaries that d depends on, or "" if there are none.
+func (d *Dict) upstreamContent(ctx context.Context) (string, error) {
+	if len(d.dependsOn) == 0 {
+		return "", nil
+	}
+
+	results := dict.Results(ctx)
+	var b strings.Builder
+	b.WriteString("\n\n以下是其他词典对该单词的查询结果（JSON），生成的内容（如词义、发音）必须与之保持一致：")
+	for _, name := range d.dependsOn {
+		v, err := json.Marshal(results[name])
+		if err != nil {
+			return "", fmt.Errorf("result of %s: %w", name, err)
+		}
+		fmt.Fprintf(&b, "\n\n[%s]\n%s", name, v)
+	}
+	return b.String(), nil
+}
+
+// userContent builds the user message for word, appending its hints
+// one per line so the model can target the intended sense.
+func userContent(word string, hints map[string]string) string {
+	if len(hints) == 0 {
+		return word
+	}
+
+	var b strings.Builder
+	b.WriteString(word)
+	for _, key := range slices.Sorted(maps.Keys(hints)) {
+		fmt.Fprintf(&b, "\n%s: %s", key, hints[key])
+	}
+	return b.String()
+}
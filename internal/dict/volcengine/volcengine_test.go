@@ -0,0 +1,150 @@
+package volcengine
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lftk/anki-vocab/internal/dict"
+)
+
+// fakeModel is a chat completion server answering with its responses in
+// turn, recording the messages of each request.
+type fakeModel struct {
+	mu        sync.Mutex
+	responses []string
+	requests  [][]string
+}
+
+func (m *fakeModel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Messages []struct {
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m.mu.Lock()
+	var contents []string
+	for _, msg := range req.Messages {
+		contents = append(contents, msg.Content)
+	}
+	m.requests = append(m.requests, contents)
+	content := m.responses[0]
+	m.responses = m.responses[1:]
+	m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":      "1",
+		"object":  "chat.completion",
+		"choices": []any{map[string]any{"index": 0, "message": map[string]any{"role": "assistant", "content": content}}},
+		"usage":   map[string]any{"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15},
+	})
+}
+
+func newTestDict(t *testing.T, m *fakeModel, cfg *Config) *dict.Dict {
+	t.Helper()
+	srv := httptest.NewServer(m)
+	t.Cleanup(srv.Close)
+	cfg.APIKey = "test"
+	cfg.HTTP.BaseURL = srv.URL
+	d, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestExampleSchema(t *testing.T) {
+	s := exampleSchema(prompt)
+	if s == nil {
+		t.Fatal("no schema inferred from the default prompt")
+	}
+	if len(s.Required) == 0 || s.Properties["story"] == nil {
+		t.Errorf("schema of the default prompt = %+v, want its example fields", s)
+	}
+
+	if s := exampleSchema("请为 {{.word}} 生成内容，不要使用 JSON。"); s != nil {
+		t.Errorf("schema inferred from a prompt without example: %+v", s)
+	}
+	s = exampleSchema(`为 {{.word}} 生成：{"meaning": "...", "examples": ["..."]}`)
+	if s == nil || len(s.Required) != 2 {
+		t.Errorf("schema = %+v, want the fields meaning and examples", s)
+	}
+}
+
+func TestQueryRepairs(t *testing.T) {
+	m := &fakeModel{responses: []string{
+		`{"meaning": 1}`,
+		"```json\n{\"meaning\": \"苹果\"}\n```",
+	}}
+	d := newTestDict(t, m, &Config{Prompt: `为 {{.word}} 生成：{"meaning": "..."}`})
+
+	stats := dict.NewStats(0)
+	b, err := d.Queryer.Query(dict.WithStats(context.Background(), stats), "apple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(dict.Unquote(b)); got != `{"meaning": "苹果"}` {
+		t.Errorf("Query() = %s", got)
+	}
+	if len(m.requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(m.requests))
+	}
+	repair := m.requests[1][len(m.requests[1])-1]
+	if !strings.Contains(repair, "/meaning: expected string, got number") {
+		t.Errorf("repair request does not name the violation: %q", repair)
+	}
+	if got := stats.Repaired(); len(got) != 1 || got[0] != "apple" {
+		t.Errorf("repaired = %v, want [apple]", got)
+	}
+	if got := stats.TotalUsage().TotalTokens(); got != 30 {
+		t.Errorf("used %d tokens, want 30", got)
+	}
+}
+
+func TestQueryRepairsGiveUp(t *testing.T) {
+	m := &fakeModel{responses: []string{`{}`, `{}`}}
+	d := newTestDict(t, m, &Config{Prompt: `{"meaning": "..."}`, MaxRepairs: 1})
+	if _, err := d.Queryer.Query(context.Background(), "apple"); err == nil {
+		t.Fatal("Query() succeeded with responses not matching the schema")
+	}
+	if len(m.requests) != 2 {
+		t.Errorf("got %d requests, want 2", len(m.requests))
+	}
+}
+
+// TestQueryDeckPromptSchema checks that responses to a deck prompt are
+// validated against the example of that prompt, not the default one.
+func TestQueryDeckPromptSchema(t *testing.T) {
+	m := &fakeModel{responses: []string{`{"mnemonic": "谐音"}`}}
+	d := newTestDict(t, m, &Config{
+		Prompt: `为 {{.word}} 生成：{"meaning": "..."}`,
+		DeckPrompts: map[string]string{
+			"考研": `为 {{.word}} 生成：{"mnemonic": "..."}`,
+		},
+	})
+
+	ctx := dict.WithEntry(context.Background(), &dict.Entry{Deck: "考研::Unit 1"})
+	b, err := d.Queryer.Query(ctx, "apple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"mnemonic": "谐音"}` {
+		t.Errorf("Query() = %s", b)
+	}
+	if len(m.requests) != 1 {
+		t.Errorf("got %d requests, want 1 without repairs", len(m.requests))
+	}
+	if system := m.requests[0][0]; !strings.Contains(system, "mnemonic") {
+		t.Errorf("system prompt = %q, want the deck prompt", system)
+	}
+}
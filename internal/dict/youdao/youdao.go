@@ -13,33 +13,52 @@ import (
 	"time"
 
 	"github.com/lftk/anki-vocab/internal/dict"
+	"github.com/lftk/anki-vocab/internal/httpclient"
 )
 
 type Config struct {
 	UserAgent string `yaml:"user_agent"`
+
+	// HTTP configures the client, e.g. its timeout or proxy. Its base_url
+	// replaces https://dict.youdao.com, e.g. with a mock server.
+	HTTP httpclient.Config `yaml:"http"`
 }
 
-func New(cfg *Config) *dict.Dict {
+const (
+	defaultBaseURL = "https://dict.youdao.com"
+	defaultTimeout = 30 * time.Second
+)
+
+func New(cfg *Config) (*dict.Dict, error) {
+	client, err := httpclient.New(&cfg.HTTP, defaultTimeout)
+	if err != nil {
+		return nil, err
+	}
 	d := &Dict{
-		client:    http.DefaultClient,
+		client:    client,
+		baseURL:   strings.TrimSuffix(cmp.Or(cfg.HTTP.BaseURL, defaultBaseURL), "/"),
 		userAgent: cmp.Or(cfg.UserAgent, defaultUserAgent),
 	}
 	caps := &dict.Capabilities{
 		Query: &dict.QueryCapabilities{
-			AI: false,
+			AI:        false,
+			WordForms: []string{"ec", "word", "wfs", "wf", "value"},
 		},
 		Pronounce: &dict.PronounceCapabilities{
-			Accents: []string{"us", "uk"},
-			Formats: []string{"mp3"},
+			Accents:   []string{"us", "uk"},
+			Formats:   []string{"mp3"},
+			Sentences: true,
 		},
+		Media: []dict.MediaKind{dict.MediaAudio},
 	}
-	return &dict.Dict{Queryer: d, Pronouncer: d, Capabilities: caps}
+	return &dict.Dict{Queryer: d, Pronouncer: d, Capabilities: caps}, nil
 }
 
 var defaultUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/139.0.0.0 Safari/537.36"
 
 type Dict struct {
 	client    *http.Client
+	baseURL   string
 	userAgent string
 }
 
@@ -58,7 +77,7 @@ func (d *Dict) Query(ctx context.Context, word string) ([]byte, error) {
 	)
 	vals.Set("sign", md5Sum(s))
 
-	url := "https://dict.youdao.com/jsonapi_s?doctype=json&jsonversion=4"
+	url := d.baseURL + "/jsonapi_s?doctype=json&jsonversion=4"
 	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(vals.Encode()))
 	if err != nil {
 		return nil, err
@@ -108,7 +127,7 @@ func (d *Dict) pronounce(ctx context.Context, word, typ string) (io.ReadCloser,
 	vals.Set("audio", word)
 	vals.Set("type", typ)
 
-	url := "https://dict.youdao.com/dictvoice?" + vals.Encode()
+	url := d.baseURL + "/dictvoice?" + vals.Encode()
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
@@ -158,7 +177,7 @@ func (d *Dict) pronounce2(ctx context.Context, word, typ string) (io.ReadCloser,
 	vals.Set("pointParam", strings.Join(keys, ","))
 	vals.Del("key")
 
-	url := "https://dict.youdao.com/pronounce/base?" + vals.Encode()
+	url := d.baseURL + "/pronounce/base?" + vals.Encode()
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,73 @@
+package youdao
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/lftk/anki-vocab/internal/httpclient"
+)
+
+func TestBaseURL(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		reqs []*http.Request
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		reqs = append(reqs, r.Clone(context.Background()))
+		mu.Unlock()
+		io.WriteString(w, "response")
+	}))
+	defer srv.Close()
+
+	d, err := New(&Config{
+		UserAgent: "agent",
+		HTTP: httpclient.Config{
+			BaseURL: srv.URL + "/mock/",
+			Headers: map[string]string{"Referer": "https://example.com/", "X-Token": "secret"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	b, err := d.Queryer.Query(ctx, "run")
+	if err != nil || string(b) != "response" {
+		t.Fatalf("Query() = %q, %v", b, err)
+	}
+	rc, err := d.Pronouncer.Pronounce(ctx, "run", "uk", "mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reqs) != 2 {
+		t.Fatalf("got %d requests, want 2", len(reqs))
+	}
+	for i, path := range []string{"/mock/jsonapi_s", "/mock/dictvoice"} {
+		r := reqs[i]
+		if r.URL.Path != path {
+			t.Errorf("request %d: path = %q, want %q", i, r.URL.Path, path)
+		}
+		for key, want := range map[string]string{
+			"User-Agent": "agent",
+			"Origin":     "https://www.youdao.com",
+			"Referer":    "https://example.com/",
+			"X-Token":    "secret",
+		} {
+			if v := r.Header.Get(key); v != want {
+				t.Errorf("request %d: header %s = %q, want %q", i, key, v, want)
+			}
+		}
+	}
+	if q := reqs[1].URL.Query(); q.Get("audio") != "run" || q.Get("type") != "1" {
+		t.Errorf("pronunciation query = %q, want the uk audio of run", q.Encode())
+	}
+}
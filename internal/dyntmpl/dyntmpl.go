@@ -1,11 +1,14 @@
 package dyntmpl
 
 import (
+	"fmt"
 	"html/template"
 	"io"
+	"maps"
 	"slices"
 	"text/template/parse"
 
+	"github.com/lftk/anki-vocab/internal/set"
 	"github.com/lftk/anki-vocab/internal/tmplinspect"
 )
 
@@ -13,13 +16,16 @@ type Template struct {
 	tmpl   *template.Template
 	fields []string
 	funcs  []string
-}
 
-func Parse(name, tmpl string) (*Template, error) {
-	t := parse.New(name)
-	t.Mode = parse.SkipFuncCheck
+	// The fields and funcs evaluated on every execution.
+	eagerFields []string
+	eagerFuncs  []string
+}
 
-	t, err := t.Parse(tmpl, "", "", make(map[string]*parse.Tree))
+// Parse parses the template tmpl. It may call any of partials, a map from
+// names to templates, as in {{template "name" .}}.
+func Parse(name, tmpl string, partials map[string]string) (*Template, error) {
+	t, err := parseTree(name, tmpl)
 	if err != nil {
 		return nil, err
 	}
@@ -29,18 +35,116 @@ func Parse(name, tmpl string) (*Template, error) {
 		return nil, err
 	}
 
+	eagerFields, eagerFuncs, err := tmplinspect.InspectUnconditional(t)
+	if err != nil {
+		return nil, err
+	}
+
+	rewriteRoot(t)
+	eagerCalls := unconditionalCalls(t.Root, nil)
+
 	tt, err := template.New(name).AddParseTree(name, t)
 	if err != nil {
 		return nil, err
 	}
 
+	// Add the partials called by the template, and those they call in turn.
+	eagerPartials := make(map[string]eagerPartial)
+	added := set.Make[string]()
+	pending := templateCalls(t.Root, nil)
+	for len(pending) > 0 {
+		call := pending[0]
+		pending = pending[1:]
+		if added.Contains(call) {
+			continue
+		}
+		added.Add(call)
+
+		partial, root := parsePartialName(call)
+		text, ok := partials[partial]
+		if !ok {
+			return nil, fmt.Errorf("template %q: no such partial %q", name, partial)
+		}
+
+		pt, err := parseTree(call, text)
+		if err != nil {
+			return nil, err
+		}
+
+		pfields, pfuncs, err := tmplinspect.InspectTree(pt)
+		if err != nil {
+			return nil, err
+		}
+		funcs = append(funcs, pfuncs...)
+
+		var eager eagerPartial
+		if eager.fields, eager.funcs, err = tmplinspect.InspectUnconditional(pt); err != nil {
+			return nil, err
+		}
+
+		if root {
+			// Only in this variant the fields are those of the data.
+			fields = append(fields, pfields...)
+			rewriteRoot(pt)
+		} else {
+			eager.fields = nil
+			renameCalls(pt.Root)
+		}
+		eager.calls = unconditionalCalls(pt.Root, nil)
+		eagerPartials[call] = eager
+
+		if _, err = tt.AddParseTree(call, pt); err != nil {
+			return nil, err
+		}
+		pending = templateCalls(pt.Root, pending)
+	}
+
+	// The partials called on every execution evaluate their own eager
+	// fields and funcs on every execution too.
+	called := set.Make[string]()
+	for len(eagerCalls) > 0 {
+		call := eagerCalls[0]
+		eagerCalls = eagerCalls[1:]
+		if called.Contains(call) {
+			continue
+		}
+		called.Add(call)
+
+		eager := eagerPartials[call]
+		eagerFields = append(eagerFields, eager.fields...)
+		eagerFuncs = append(eagerFuncs, eager.funcs...)
+		eagerCalls = append(eagerCalls, eager.calls...)
+	}
+
 	return &Template{
-		tmpl:   tt,
-		fields: fields,
-		funcs:  funcs,
+		tmpl:        tt,
+		fields:      sortedUnique(fields),
+		funcs:       sortedUnique(funcs),
+		eagerFields: sortedUnique(eagerFields),
+		eagerFuncs:  sortedUnique(eagerFuncs),
 	}, nil
 }
 
+// eagerPartial holds what a partial evaluates on every execution: its
+// fields, which are only those of the data in the root variant, its funcs
+// and the partials it calls.
+type eagerPartial struct {
+	fields []string
+	funcs  []string
+	calls  []string
+}
+
+func parseTree(name, tmpl string) (*parse.Tree, error) {
+	t := parse.New(name)
+	t.Mode = parse.SkipFuncCheck
+	return t.Parse(tmpl, "", "", make(map[string]*parse.Tree))
+}
+
+func sortedUnique(s []string) []string {
+	slices.Sort(s)
+	return slices.Compact(s)
+}
+
 func (t *Template) Name() string {
 	return t.tmpl.Name()
 }
@@ -53,12 +157,28 @@ func (t *Template) Funcs() []string {
 	return slices.Clone(t.funcs)
 }
 
+// EagerFields returns the fields evaluated on every execution, as opposed
+// to those only evaluated in some branches of the template.
+func (t *Template) EagerFields() []string {
+	return slices.Clone(t.eagerFields)
+}
+
+// EagerFuncs returns the funcs called on every execution.
+func (t *Template) EagerFuncs() []string {
+	return slices.Clone(t.eagerFuncs)
+}
+
 type FuncMap = template.FuncMap
 
-func (t *Template) Execute(w io.Writer, funcs FuncMap, data any) error {
+// Execute applies the template, calling resolve for the top-level fields
+// of the data the first time they are evaluated.
+func (t *Template) Execute(w io.Writer, funcs FuncMap, resolve Resolver) error {
 	tt, err := t.tmpl.Clone()
 	if err != nil {
 		return err
 	}
-	return tt.Funcs(funcs).Execute(w, data)
+	fm := make(FuncMap, len(funcs)+1)
+	maps.Copy(fm, funcs)
+	fm[resolveFunc] = resolve
+	return tt.Funcs(fm).Execute(w, nil)
 }
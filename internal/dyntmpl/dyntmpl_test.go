@@ -0,0 +1,201 @@
+package dyntmpl
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var testData = map[string]any{
+	"word": "run",
+	"a":    map[string]any{"x": false, "y": "ay"},
+	"b":    map[string]any{"x": true, "y": "by"},
+	"list": []any{map[string]any{"y": "l1"}, map[string]any{"y": "l2"}},
+}
+
+// execute executes tmpl and returns its output and the names resolved, in
+// the order they were first asked for.
+func execute(t *testing.T, tmpl *Template) (string, []string) {
+	t.Helper()
+	var resolved []string
+	resolve := func(name string) (any, error) {
+		resolved = append(resolved, name)
+		v, ok := testData[name]
+		if !ok {
+			return nil, fmt.Errorf("no field %q", name)
+		}
+		return v, nil
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, nil, resolve); err != nil {
+		t.Fatal(err)
+	}
+	return sb.String(), resolved
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		tmpl     string
+		want     string
+		resolved []string
+	}{
+		{"{{.word}}", "run", []string{"word"}},
+		{"{{if .a.x}}{{.b.y}}{{end}}", "", []string{"a"}},
+		{"{{if .a.x}}{{.b.y}}{{else}}{{.a.y}}{{end}}", "ay", []string{"a", "a"}},
+		{"{{if .b.x}}{{.b.y}}{{end}}", "by", []string{"b", "b"}},
+		{"{{range .list}}{{.y}} {{$.word}} {{end}}", "l1 run l2 run ", []string{"list", "word", "word"}},
+		{"{{with .b}}{{.y}} {{$.a.y}}{{end}}", "by ay", []string{"b", "a"}},
+		{"{{with .a}}{{if .x}}{{$.b.y}}{{end}}{{end}}", "", []string{"a"}},
+		{"{{$v := .b}}{{$v.y}} {{$v.x}}", "by true", []string{"b"}},
+		{"{{$v := .a}}{{if $v.x}}{{.b.y}}{{end}}", "", []string{"a"}},
+		{"{{$.word}}", "run", []string{"word"}},
+	}
+	for _, tt := range tests {
+		tmpl, err := Parse("test", tt.tmpl, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, resolved := execute(t, tmpl)
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.tmpl, got, tt.want)
+		}
+		if !slices.Equal(resolved, tt.resolved) {
+			t.Errorf("%s: resolved %q, want %q", tt.tmpl, resolved, tt.resolved)
+		}
+	}
+}
+
+func TestExecutePartials(t *testing.T) {
+	partials := map[string]string{
+		"y":     "{{.y}}",
+		"word":  "{{.word}}",
+		"root":  "{{$.word}} {{template \"word\" .}}",
+		"inner": "{{template \"y\" .}} {{$.y}}",
+		"cond":  "{{if .a.x}}{{.b.y}}{{end}}",
+	}
+	tests := []struct {
+		tmpl     string
+		want     string
+		resolved []string
+	}{
+		{`{{template "word" .}}`, "run", []string{"word"}},
+		{`{{template "root" .}}`, "run run", []string{"word", "word"}},
+		{`{{with .b}}{{template "word" $}}{{end}}`, "run", []string{"b", "word"}},
+		{`{{template "y" .b}}`, "by", []string{"b"}},
+		{`{{with .a}}{{template "y" .}}{{end}}`, "ay", []string{"a"}},
+		{`{{template "inner" .b}}`, "by by", []string{"b"}},
+		{`{{range .list}}{{template "y" .}}{{end}}`, "l1l2", []string{"list"}},
+		{`{{template "cond" .}}`, "", []string{"a"}},
+		{`{{template "y" .a}}{{template "word" .}}`, "ayrun", []string{"a", "word"}},
+	}
+	for _, tt := range tests {
+		tmpl, err := Parse("test", tt.tmpl, partials)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, resolved := execute(t, tmpl)
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.tmpl, got, tt.want)
+		}
+		if !slices.Equal(resolved, tt.resolved) {
+			t.Errorf("%s: resolved %q, want %q", tt.tmpl, resolved, tt.resolved)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{"{{.word", "unclosed action"},
+		{`{{template "missing" .}}`, `no such partial "missing"`},
+		{`{{template "bad" .}}`, "unexpected"},
+	}
+	partials := map[string]string{"bad": "{{end}}"}
+	for _, tt := range tests {
+		_, err := Parse("test", tt.tmpl, partials)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.tmpl, err, tt.want)
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+	partials := map[string]string{
+		"word":  "{{.word}} {{upper .a.y}}",
+		"y":     "{{.y}} {{lower .y}}",
+		"cond":  "{{if .a.x}}{{.b.y}}{{end}}",
+		"outer": `{{template "word" .}}`,
+	}
+	tests := []struct {
+		tmpl        string
+		fields      []string
+		funcs       []string
+		eagerFields []string
+		eagerFuncs  []string
+	}{
+		{
+			tmpl:        "{{if .a.x}}{{upper .b.y}}{{end}}",
+			fields:      []string{"a.x", "b.y"},
+			funcs:       []string{"upper"},
+			eagerFields: []string{"a.x"},
+		},
+		{
+			tmpl:        "{{range .list}}{{.y}}{{end}} {{$.word}}",
+			fields:      []string{"list", "list.y", "word"},
+			eagerFields: []string{"list", "word"},
+		},
+		{
+			tmpl:        `{{template "word" .}}`,
+			fields:      []string{"a.y", "word"},
+			funcs:       []string{"upper"},
+			eagerFields: []string{"a.y", "word"},
+			eagerFuncs:  []string{"upper"},
+		},
+		{
+			tmpl:        `{{template "outer" $}}`,
+			fields:      []string{"a.y", "word"},
+			funcs:       []string{"upper"},
+			eagerFields: []string{"a.y", "word"},
+			eagerFuncs:  []string{"upper"},
+		},
+		{
+			tmpl:        `{{template "cond" .}}`,
+			fields:      []string{"a.x", "b.y"},
+			eagerFields: []string{"a.x"},
+		},
+		{
+			tmpl:        `{{if .b.x}}{{template "word" .}}{{end}}`,
+			fields:      []string{"a.y", "b.x", "word"},
+			funcs:       []string{"upper"},
+			eagerFields: []string{"b.x"},
+		},
+		{
+			tmpl:        `{{template "y" .b}}`,
+			fields:      []string{"b"},
+			funcs:       []string{"lower"},
+			eagerFields: []string{"b"},
+			eagerFuncs:  []string{"lower"},
+		},
+	}
+	for _, tt := range tests {
+		tmpl, err := Parse("test", tt.tmpl, partials)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tmpl.Fields(); !slices.Equal(got, tt.fields) {
+			t.Errorf("%s: Fields() = %q, want %q", tt.tmpl, got, tt.fields)
+		}
+		if got := tmpl.Funcs(); !slices.Equal(got, tt.funcs) {
+			t.Errorf("%s: Funcs() = %q, want %q", tt.tmpl, got, tt.funcs)
+		}
+		if got := tmpl.EagerFields(); !slices.Equal(got, tt.eagerFields) {
+			t.Errorf("%s: EagerFields() = %q, want %q", tt.tmpl, got, tt.eagerFields)
+		}
+		if got := tmpl.EagerFuncs(); !slices.Equal(got, tt.eagerFuncs) {
+			t.Errorf("%s: EagerFuncs() = %q, want %q", tt.tmpl, got, tt.eagerFuncs)
+		}
+	}
+}
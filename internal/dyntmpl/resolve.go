@@ -0,0 +1,219 @@
+package dyntmpl
+
+import (
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// resolveFunc is the name of the function that root field accesses are
+// rewritten to call.
+const resolveFunc = "_resolve"
+
+// Resolver returns the value of a top-level field, such as "youdao" in
+// ".youdao.ec.word". It is called when the field is first evaluated.
+type Resolver func(name string) (any, error)
+
+// rewriteRoot rewrites every access to a top-level field of the data, such as
+// ".youdao.ec.word" or "$.youdao.ec.word", into a call of the resolve
+// function, as in "(_resolve "youdao").ec.word".
+func rewriteRoot(t *parse.Tree) {
+	rewriteList(t.Root, true)
+}
+
+// rewriteList rewrites the nodes of a list. root reports whether dot is the
+// root of the data, which is no longer the case inside range and with.
+func rewriteList(l *parse.ListNode, root bool) {
+	if l == nil {
+		return
+	}
+	for _, node := range l.Nodes {
+		switch n := node.(type) {
+		case *parse.ActionNode:
+			rewritePipe(n.Pipe, root)
+
+		case *parse.IfNode:
+			rewritePipe(n.Pipe, root)
+			rewriteList(n.List, root)
+			rewriteList(n.ElseList, root)
+
+		case *parse.RangeNode:
+			rewritePipe(n.Pipe, root)
+			rewriteList(n.List, false)
+			rewriteList(n.ElseList, root)
+
+		case *parse.WithNode:
+			rewritePipe(n.Pipe, root)
+			rewriteList(n.List, false)
+			rewriteList(n.ElseList, root)
+
+		case *parse.TemplateNode:
+			rewritePipe(n.Pipe, root)
+			n.Name = partialName(n.Name, isRootPipe(n.Pipe, root))
+		}
+	}
+}
+
+// partialPrefix keeps the names of partials apart from the field templates.
+const partialPrefix = "partials/"
+
+// rootSuffix marks the variant of a partial whose dot is the root of the
+// data, so that its field accesses are rewritten as well.
+const rootSuffix = "@root"
+
+func partialName(name string, root bool) string {
+	name = partialPrefix + name
+	if root {
+		name += rootSuffix
+	}
+	return name
+}
+
+func parsePartialName(name string) (string, bool) {
+	name = strings.TrimPrefix(name, partialPrefix)
+	return strings.CutSuffix(name, rootSuffix)
+}
+
+// isRootPipe reports whether the pipe passes the root of the data, as in
+// {{template "name" .}} at the top level or {{template "name" $}}.
+func isRootPipe(p *parse.PipeNode, root bool) bool {
+	if p == nil || len(p.Decl) > 0 || len(p.Cmds) != 1 || len(p.Cmds[0].Args) != 1 {
+		return false
+	}
+	switch n := p.Cmds[0].Args[0].(type) {
+	case *parse.DotNode:
+		return root
+	case *parse.VariableNode:
+		return len(n.Ident) == 1 && n.Ident[0] == "$"
+	}
+	return false
+}
+
+// renameCalls renames the templates called in a partial that is not the
+// root variant, in which neither dot nor $ is the root of the data.
+func renameCalls(l *parse.ListNode) {
+	if l == nil {
+		return
+	}
+	for _, node := range l.Nodes {
+		switch n := node.(type) {
+		case *parse.IfNode:
+			renameCalls(n.List)
+			renameCalls(n.ElseList)
+
+		case *parse.RangeNode:
+			renameCalls(n.List)
+			renameCalls(n.ElseList)
+
+		case *parse.WithNode:
+			renameCalls(n.List)
+			renameCalls(n.ElseList)
+
+		case *parse.TemplateNode:
+			n.Name = partialName(n.Name, false)
+		}
+	}
+}
+
+// templateCalls appends the names of the templates called in l to calls.
+func templateCalls(l *parse.ListNode, calls []string) []string {
+	if l == nil {
+		return calls
+	}
+	for _, node := range l.Nodes {
+		switch n := node.(type) {
+		case *parse.IfNode:
+			calls = templateCalls(n.List, calls)
+			calls = templateCalls(n.ElseList, calls)
+
+		case *parse.RangeNode:
+			calls = templateCalls(n.List, calls)
+			calls = templateCalls(n.ElseList, calls)
+
+		case *parse.WithNode:
+			calls = templateCalls(n.List, calls)
+			calls = templateCalls(n.ElseList, calls)
+
+		case *parse.TemplateNode:
+			calls = append(calls, n.Name)
+		}
+	}
+	return calls
+}
+
+// unconditionalCalls appends the names of the templates called in l outside
+// the branches of if, range and with actions to calls.
+func unconditionalCalls(l *parse.ListNode, calls []string) []string {
+	if l == nil {
+		return calls
+	}
+	for _, node := range l.Nodes {
+		if n, ok := node.(*parse.TemplateNode); ok {
+			calls = append(calls, n.Name)
+		}
+	}
+	return calls
+}
+
+func rewritePipe(p *parse.PipeNode, root bool) {
+	if p == nil {
+		return
+	}
+	for _, cmd := range p.Cmds {
+		for i, arg := range cmd.Args {
+			cmd.Args[i] = rewriteArg(arg, root)
+		}
+	}
+}
+
+func rewriteArg(node parse.Node, root bool) parse.Node {
+	switch n := node.(type) {
+	case *parse.FieldNode:
+		if root {
+			return resolveChain(n.Pos, n.Ident)
+		}
+
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			return resolveChain(n.Pos, n.Ident[1:])
+		}
+
+	case *parse.ChainNode:
+		n.Node = rewriteArg(n.Node, root)
+
+	case *parse.PipeNode:
+		rewritePipe(n, root)
+	}
+	return node
+}
+
+// resolveChain builds the node for "(_resolve "ident[0]").ident[1:]...".
+func resolveChain(pos parse.Pos, ident []string) parse.Node {
+	name := ident[0]
+	pipe := &parse.PipeNode{
+		NodeType: parse.NodePipe,
+		Pos:      pos,
+		Cmds: []*parse.CommandNode{{
+			NodeType: parse.NodeCommand,
+			Pos:      pos,
+			Args: []parse.Node{
+				parse.NewIdentifier(resolveFunc).SetPos(pos),
+				&parse.StringNode{
+					NodeType: parse.NodeString,
+					Pos:      pos,
+					Quoted:   strconv.Quote(name),
+					Text:     name,
+				},
+			},
+		}},
+	}
+	if len(ident) == 1 {
+		return pipe
+	}
+	return &parse.ChainNode{
+		NodeType: parse.NodeChain,
+		Pos:      pos,
+		Node:     pipe,
+		Field:    ident[1:],
+	}
+}
@@ -0,0 +1,48 @@
+package generate
+
+import (
+	"context"
+	"slices"
+
+	"github.com/lftk/anki-vocab/internal/dict"
+	"github.com/lftk/anki-vocab/internal/utils"
+	"github.com/lftk/anki-vocab/internal/wordlist"
+)
+
+// Prepare queries the words at once, in batches, from the dictionaries that
+// support it, so that generating them does not take a request per word.
+// Only dictionaries used unconditionally by the templates are queried, as
+// the others may not be needed for every word. Words with hints are left
+// to be queried one by one, like the words missing from a batch result.
+//
+// Prepare must be called before Generate, not concurrently with it.
+func (g *Generator) Prepare(ctx context.Context, words []*wordlist.Word) error {
+	var texts []string
+	for _, w := range words {
+		if len(w.Hints) == 0 {
+			texts = append(texts, w.Text)
+		}
+	}
+	texts = utils.SliceUnique(texts)
+
+	for _, q := range g.queryers {
+		bq, ok := q.Dict.(dict.BatchQueryer)
+		if !ok || !q.Eager || q.Caps.BatchSize <= 0 {
+			continue
+		}
+
+		if q.batched == nil {
+			q.batched = make(map[string][]byte)
+		}
+		for batch := range slices.Chunk(texts, q.Caps.BatchSize) {
+			results, err := bq.QueryBatch(ctx, batch)
+			if err != nil {
+				return err
+			}
+			for word, b := range results {
+				q.batched[word] = b
+			}
+		}
+	}
+	return nil
+}
@@ -11,9 +11,18 @@ import (
 )
 
 type dictQueryer struct {
-	Name string
-	Dict dict.Queryer
-	Caps *dict.QueryCapabilities
+	Name  string
+	Dict  dict.Queryer
+	Caps  *dict.QueryCapabilities
+	Eager bool // Used unconditionally by some template.
+
+	// Requires are the dictionaries whose results the dictionary needs,
+	// see dict.QueryCapabilities.Requires.
+	Requires []*dictQueryer
+
+	// batched holds the results of the words queried in batches by
+	// Generator.Prepare.
+	batched map[string][]byte
 }
 
 type dictPronouncer struct {
@@ -21,6 +30,19 @@ type dictPronouncer struct {
 	Accent string
 	Dict   dict.Pronouncer
 	Caps   *dict.PronounceCapabilities
+	Eager  bool // Used unconditionally by some template.
+}
+
+func (p *dictPronouncer) format() string {
+	if len(p.Caps.Formats) > 0 {
+		return p.Caps.Formats[0]
+	}
+	return "mp3"
+}
+
+// pron identifies the pronouncer of an accent of a dictionary.
+type pron struct {
+	name, accent string
 }
 
 func loadOrNewQueryer(r *registry.Registry, name string) (*dictQueryer, error) {
@@ -46,7 +68,7 @@ func loadOrNewPronouncer(r *registry.Registry, name, accent string) (*dictPronou
 		return nil, err
 	}
 
-	if d.Pronouncer == nil || d.Capabilities.Pronounce == nil {
+	if d.Pronouncer == nil || d.Capabilities.Pronounce == nil || !d.Capabilities.HasMedia(dict.MediaAudio) {
 		return nil, fmt.Errorf("dictionary %q does not support pronunciation", name)
 	}
 	if !slices.Contains(d.Capabilities.Pronounce.Accents, accent) {
@@ -62,10 +84,6 @@ func loadOrNewPronouncer(r *registry.Registry, name, accent string) (*dictPronou
 }
 
 func buildDicts(r *registry.Registry, tmpls []*dyntmpl.Template) ([]*dictQueryer, []*dictPronouncer, error) {
-	type pron struct {
-		name, accent string
-	}
-
 	var (
 		qs linkedSet[string, *dictQueryer]
 		ps linkedSet[pron, *dictPronouncer]
@@ -99,11 +117,68 @@ func buildDicts(r *registry.Registry, tmpls []*dyntmpl.Template) ([]*dictQueryer
 		}
 	}
 
-	return qs.values(), ps.values(), nil
+	// Load the dictionaries required by others, which the templates may
+	// not use themselves.
+	for i := 0; i < len(qs.values()); i++ {
+		for _, name := range qs.values()[i].Caps.Requires {
+			_, err := qs.addFunc(name, func() (*dictQueryer, error) {
+				return loadOrNewQueryer(r, name)
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	queryers, pronouncers := qs.values(), ps.values()
+	for _, q := range queryers {
+		for _, name := range q.Caps.Requires {
+			i := slices.IndexFunc(queryers, func(q *dictQueryer) bool {
+				return q.Name == name
+			})
+			q.Requires = append(q.Requires, queryers[i])
+		}
+	}
+	if err := checkRequires(queryers); err != nil {
+		return nil, nil, err
+	}
+	for _, t := range tmpls {
+		for _, f := range t.EagerFields() {
+			name, ok := parseDictQueryer(f)
+			if !ok {
+				continue
+			}
+			for _, q := range queryers {
+				if q.Name == name {
+					q.Eager = true
+				}
+			}
+		}
+
+		for _, f := range t.EagerFuncs() {
+			name, accent, ok := parseDictPronouncer(f)
+			if !ok {
+				continue
+			}
+			for _, p := range pronouncers {
+				if p.Name == name && p.Accent == accent {
+					p.Eager = true
+				}
+			}
+		}
+	}
+
+	return queryers, pronouncers, nil
 }
 
+// reservedFields are the top-level template fields that are not dictionaries.
+var reservedFields = []string{"word", "hints", "fields"}
+
 func parseDictQueryer(field string) (string, bool) {
 	dict, _, ok := strings.Cut(field, ".")
+	if slices.Contains(reservedFields, dict) {
+		return "", false
+	}
 	return dict, ok
 }
 
@@ -117,7 +192,32 @@ func dictPronunciation(dict, accent string) string {
 
 func isDictPronunciation(fn string) (string, string, bool) {
 	if s, ok := strings.CutSuffix(fn, "_pronunciation"); ok {
-		return strings.Cut(s, "_")
+		// Accents never contain underscores, dictionary names may.
+		if i := strings.LastIndex(s, "_"); i >= 0 {
+			return s[:i], s[i+1:], true
+		}
 	}
 	return "", "", false
 }
+
+// collectStrings returns the strings found at path in v, flattening the
+// arrays along the way.
+func collectStrings(v any, path []string) []string {
+	switch v := v.(type) {
+	case []any:
+		var ss []string
+		for _, elem := range v {
+			ss = append(ss, collectStrings(elem, path)...)
+		}
+		return ss
+	case map[string]any:
+		if len(path) > 0 {
+			return collectStrings(v[path[0]], path[1:])
+		}
+	case string:
+		if len(path) == 0 && v != "" {
+			return []string{v}
+		}
+	}
+	return nil
+}
@@ -4,42 +4,91 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
 	"io"
+	"maps"
+	"net/http"
+	"slices"
 	"strings"
+	"time"
 
+	"golang.org/x/sync/errgroup"
+
+	"github.com/lftk/anki-vocab/internal/audio"
+	"github.com/lftk/anki-vocab/internal/dict"
 	"github.com/lftk/anki-vocab/internal/dyntmpl"
+	"github.com/lftk/anki-vocab/internal/httpclient"
 	"github.com/lftk/anki-vocab/internal/notetype"
 	"github.com/lftk/anki-vocab/internal/registry"
 	"github.com/lftk/anki-vocab/internal/tmplfunc"
 	"github.com/lftk/anki-vocab/internal/tmpljson"
+	"github.com/lftk/anki-vocab/internal/wordlist"
 )
 
 type Generator struct {
 	fields      []*dyntmpl.Template
+	order       []int // Execution order of fields.
 	queryers    []*dictQueryer
 	pronouncers []*dictPronouncer
+
+	// The dictionaries used by the audio function are only known when
+	// the templates are executed.
+	registry *registry.Registry
+	extra    memo[pron, *dictPronouncer]
+
+	// media names the media files of the collection by content, see
+	// mediaFilename.
+	media memo[string, string]
+
+	audio *audio.Config
+
+	client *http.Client // Downloads images.
 }
 
-func New(r *registry.Registry, fields []*notetype.Field) (*Generator, error) {
-	tmpls := make([]*dyntmpl.Template, 0, len(fields))
-	for _, f := range fields {
-		t, err := dyntmpl.Parse(f.Name, f.Template)
+// imageTimeout limits the download of an image, unless the HTTP config
+// sets another timeout.
+const imageTimeout = 30 * time.Second
+
+func New(r *registry.Registry, nt *notetype.Notetype) (*Generator, error) {
+	partials := make(map[string]string, len(nt.Partials()))
+	for _, p := range nt.Partials() {
+		partials[p.Name] = p.Template
+	}
+
+	tmpls := make([]*dyntmpl.Template, 0, len(nt.Fields()))
+	for _, f := range nt.Fields() {
+		t, err := dyntmpl.Parse(f.Name, f.Template, partials)
 		if err != nil {
 			return nil, err
 		}
 		tmpls = append(tmpls, t)
 	}
 
+	order, err := executionOrder(tmpls)
+	if err != nil {
+		return nil, err
+	}
+
 	queryers, pronouncers, err := buildDicts(r, tmpls)
 	if err != nil {
 		return nil, err
 	}
 
+	client, err := httpclient.New(r.HTTPConfig(), imageTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("http: %w", err)
+	}
+
 	return &Generator{
 		fields:      tmpls,
+		order:       order,
 		queryers:    queryers,
 		pronouncers: pronouncers,
+		registry:    r,
+		audio:       nt.Audio(),
+		client:      client,
 	}, nil
 }
 
@@ -47,110 +96,227 @@ type Writer interface {
 	Write(fields []string, media map[string]io.Reader) error
 }
 
-func (g *Generator) Generate(ctx context.Context, w Writer, word string) error {
-	data, err := g.query(ctx, word)
-	if err != nil {
+func (g *Generator) Generate(ctx context.Context, w Writer, deck *wordlist.Deck, entry *wordlist.Word) error {
+	word := entry.Text
+	s := &session{
+		word: word,
+		entry: &dict.Entry{
+			Deck:  strings.Join(deck.Path, "::"),
+			Tags:  entry.Tags,
+			Hints: entry.Hints,
+		},
+		audio: g.audio,
+	}
+	if err := g.prefetch(ctx, s); err != nil {
 		return err
 	}
 
-	type pron struct {
-		*dictPronouncer
-		Format   string
-		Filename string
-	}
-	var prons []pron
+	media := make(map[string]io.Reader)
 
 	funcs := tmplfunc.Builtins()
-	funcs["highlight_word"] = tmplfunc.Highlight(word)
 
-	for _, p := range g.pronouncers {
-		fname := dictPronunciation(p.Name, p.Accent)
-		funcs[fname] = func() string {
-			format := "mp3"
-			if len(p.Caps.Formats) > 0 {
-				format = p.Caps.Formats[0]
+	var highlight func(args ...string) (template.HTML, error)
+	funcs["highlight_word"] = func(args ...string) (template.HTML, error) {
+		if highlight == nil {
+			forms, err := g.wordForms(ctx, s)
+			if err != nil {
+				return "", err
 			}
-			filename := fmt.Sprintf(
-				"%s_%s_%s.%s", word, p.Name, p.Accent, format,
-			)
-			pron := pron{
-				dictPronouncer: p,
-				Format:         format,
-				Filename:       filename,
-			}
-			prons = append(prons, pron)
-			return fmt.Sprintf("[sound:%s]", filename)
+			highlight = tmplfunc.Highlight(word, forms...)
 		}
+		return highlight(args...)
 	}
 
-	fields, err := g.execute(word, funcs, data)
-	if err != nil {
-		return err
-	}
+	maps.Copy(funcs, g.mediaFuncs(ctx, s, media))
 
-	media := make(map[string]io.Reader)
-	for _, p := range prons {
-		audio, err := p.Dict.Pronounce(ctx, word, p.Accent, p.Format)
-		if err != nil {
-			return err
+	resolve := func(name string) (any, error) {
+		switch name {
+		case "word":
+			return word, nil
+		case "hints":
+			return entry.Hints, nil
+		}
+		i := slices.IndexFunc(g.queryers, func(q *dictQueryer) bool {
+			return q.Name == name
+		})
+		if i < 0 {
+			return nil, nil
 		}
-		defer audio.Close()
+		return s.query(ctx, g.queryers[i])
+	}
 
-		media[p.Filename] = audio
+	fields, err := g.execute(word, funcs, resolve)
+	if err != nil {
+		return err
 	}
 
 	return w.Write(fields, media)
 }
 
-func (g *Generator) query(ctx context.Context, word string) (map[string]any, error) {
-	data := map[string]any{
-		"word": word,
-	}
+// wordForms returns the inflected forms of the word found in the results of
+// the dictionaries that provide them.
+func (g *Generator) wordForms(ctx context.Context, s *session) ([]string, error) {
+	var forms []string
 	for _, q := range g.queryers {
-		b, err := q.Dict.Query(ctx, word)
+		if len(q.Caps.WordForms) == 0 {
+			continue
+		}
+		data, err := s.query(ctx, q)
 		if err != nil {
 			return nil, err
 		}
+		forms = append(forms, collectStrings(data, q.Caps.WordForms)...)
+	}
+	return forms, nil
+}
 
+// session holds the dictionary data of a single word. Each dictionary is
+// queried on first use, at most once per word.
+type session struct {
+	word    string
+	entry   *dict.Entry
+	audio   *audio.Config
+	results memo[*dictQueryer, map[string]any]
+	sounds  memo[soundKey, *sound]
+	images  memo[string, *image]
+}
+
+type soundKey struct {
+	p    *dictPronouncer
+	text string
+}
+
+func (s *session) query(ctx context.Context, q *dictQueryer) (map[string]any, error) {
+	return s.results.do(q, func() (map[string]any, error) {
 		if q.Caps.AI {
-			b = unquote(b)
+			// Only AI dictionaries can make use of the wordlist entry.
+			ctx = dict.WithEntry(ctx, s.entry)
 		}
-		b, err = tmpljson.Normalize(b)
-		if err != nil {
+		if len(q.Requires) > 0 {
+			results := make(map[string]any, len(q.Requires))
+			for _, r := range q.Requires {
+				data, err := s.query(ctx, r)
+				if err != nil {
+					return nil, err
+				}
+				results[r.Name] = data
+			}
+			ctx = dict.WithResults(ctx, results)
+		}
+		return query(ctx, q, s.word)
+	})
+}
+
+// pronounce returns the processed pronunciation of text, or nil if the
+// dictionary has none.
+func (s *session) pronounce(ctx context.Context, p *dictPronouncer, text string) (*sound, error) {
+	return s.sounds.do(soundKey{p, text}, func() (*sound, error) {
+		data, err := pronounce(ctx, p, text)
+		if err != nil || data == nil {
 			return nil, err
 		}
+		data, format, err := audio.Process(ctx, data, p.format(), s.audio)
+		if err != nil {
+			return nil, fmt.Errorf("process %s audio of %q: %w", p.Name, text, err)
+		}
+		return &sound{data: data, format: format}, nil
+	})
+}
+
+type sound struct {
+	data   []byte
+	format string
+}
+
+// prefetch concurrently runs the queries and pronunciations that the
+// templates use unconditionally. The first error cancels the others.
+// Everything else is fetched lazily while the templates are executed.
+func (g *Generator) prefetch(ctx context.Context, s *session) error {
+	eg, ctx := errgroup.WithContext(ctx)
+	for _, q := range g.queryers {
+		if q.Eager {
+			eg.Go(func() error {
+				_, err := s.query(ctx, q)
+				return err
+			})
+		}
+	}
+	for _, p := range g.pronouncers {
+		if p.Eager {
+			eg.Go(func() error {
+				_, err := s.pronounce(ctx, p, s.word)
+				return err
+			})
+		}
+	}
+	return eg.Wait()
+}
 
-		var m map[string]any
-		err = json.Unmarshal(b, &m)
+func query(ctx context.Context, q *dictQueryer, word string) (map[string]any, error) {
+	b, ok := q.batched[word]
+	if !ok || len(dict.Hints(ctx)) > 0 {
+		var err error
+		b, err = q.Dict.Query(ctx, word)
+		if errors.Is(err, dict.ErrNotFound) {
+			// Fields using a dictionary that lacks the word are empty.
+			return map[string]any{}, nil
+		}
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		data[q.Name] = m
+	if q.Caps.AI {
+		b = dict.Unquote(b)
 	}
-	return data, nil
+	b, err := tmpljson.Normalize(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]any
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
 }
 
-func (g *Generator) execute(word string, funcs dyntmpl.FuncMap, data any) ([]string, error) {
-	fields := make([]string, 0, len(g.fields)+1)
-	fields = append(fields, word)
-	for _, t := range g.fields {
+func pronounce(ctx context.Context, p *dictPronouncer, word string) ([]byte, error) {
+	audio, err := p.Dict.Pronounce(ctx, word, p.Accent, p.format())
+	if errors.Is(err, dict.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer audio.Close()
+
+	return io.ReadAll(audio)
+}
+
+// execute renders the fields in dependency order, making the output of
+// each field available to the following ones as .fields.<name>.
+func (g *Generator) execute(word string, funcs dyntmpl.FuncMap, resolve dyntmpl.Resolver) ([]string, error) {
+	rendered := make(map[string]template.HTML, len(g.fields))
+	resolveField := func(name string) (any, error) {
+		if name == "fields" {
+			return rendered, nil
+		}
+		return resolve(name)
+	}
+
+	fields := make([]string, len(g.fields)+1)
+	fields[0] = word
+	for _, i := range g.order {
+		t := g.fields[i]
 		var buf bytes.Buffer
-		err := t.Execute(&buf, funcs, data)
+		err := t.Execute(&buf, funcs, resolveField)
 		if err != nil {
 			return nil, err
 		}
-		fields = append(fields, strings.TrimSpace(buf.String()))
+		fields[i+1] = strings.TrimSpace(buf.String())
+		rendered[t.Name()] = template.HTML(fields[i+1])
 	}
 	return fields, nil
 }
-
-func unquote(b []byte) []byte {
-	b = bytes.TrimSpace(b)
-	if bytes.HasPrefix(b, []byte("```")) && bytes.HasSuffix(b, []byte("```")) {
-		b = b[3 : len(b)-3]
-		b = bytes.TrimPrefix(b, []byte("json"))
-		return bytes.TrimSpace(b)
-	}
-	return b
-}
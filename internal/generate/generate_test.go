@@ -0,0 +1,171 @@
+package generate
+
+import (
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/lftk/anki-vocab/internal/dict"
+	"github.com/lftk/anki-vocab/internal/notetype"
+	"github.com/lftk/anki-vocab/internal/registry"
+	"github.com/lftk/anki-vocab/internal/wordlist"
+)
+
+// hintsQueryer is an AI dictionary that records the hints it is queried with.
+type hintsQueryer struct {
+	hints map[string]string
+}
+
+func (q *hintsQueryer) Query(ctx context.Context, word string) ([]byte, error) {
+	q.hints = dict.Hints(ctx)
+	return []byte(`{"word": "` + word + `"}`), nil
+}
+
+// notFoundQueryer is a dictionary that has no word.
+type notFoundQueryer struct{}
+
+func (notFoundQueryer) Query(ctx context.Context, word string) ([]byte, error) {
+	return nil, dict.ErrNotFound
+}
+
+func TestQueryFallbackAIMemberGetsEntry(t *testing.T) {
+	ai := &hintsQueryer{}
+	d := dict.Fallback([]*dict.FallbackMember{
+		{
+			Name: "plain",
+			Dict: &dict.Dict{
+				Queryer:      notFoundQueryer{},
+				Capabilities: &dict.Capabilities{Query: &dict.QueryCapabilities{}},
+			},
+		},
+		{
+			Name: "ai",
+			Dict: &dict.Dict{
+				Queryer:      ai,
+				Capabilities: &dict.Capabilities{Query: &dict.QueryCapabilities{AI: true}},
+			},
+		},
+	}, false)
+	if !d.Capabilities.Query.AI {
+		t.Fatal("fallback chain with an AI member is not an AI dictionary")
+	}
+
+	hints := map[string]string{"pos": "n."}
+	s := &session{word: "bank", entry: &dict.Entry{Hints: hints}}
+	q := &dictQueryer{Name: "definitions", Dict: d.Queryer, Caps: d.Capabilities.Query}
+	data, err := s.query(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["word"] != "bank" {
+		t.Errorf("query result = %v, want the result of the AI member", data)
+	}
+	if !maps.Equal(ai.hints, hints) {
+		t.Errorf("AI member got hints %v, want %v", ai.hints, hints)
+	}
+}
+
+func TestQueryNotFound(t *testing.T) {
+	s := &session{word: "pear", entry: &dict.Entry{}}
+	q := &dictQueryer{Name: "ecdict", Dict: notFoundQueryer{}, Caps: &dict.QueryCapabilities{}}
+	data, err := s.query(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 0 {
+		t.Errorf("query result = %v, want an empty result", data)
+	}
+}
+
+// notes collects the fields of the generated notes.
+type notes [][]string
+
+func (n *notes) Write(fields []string, media map[string]io.Reader) error {
+	*n = append(*n, fields)
+	return nil
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// generate generates the notes of words with a note type whose fields are
+// the word and its translation in the local dictionary ecdict.
+func generate(t *testing.T, r *registry.Registry, words ...string) (notes, error) {
+	t.Helper()
+	nt, err := notetype.Load("test", fstest.MapFS{
+		"fields/1_word.tmpl":        {Data: []byte("{{.word}}")},
+		"fields/2_translation.tmpl": {Data: []byte("{{.ecdict.translation}}")},
+		"templates/card/front.html": {Data: []byte("{{1_word}}")},
+		"templates/card/back.html":  {Data: []byte("{{2_translation}}")},
+		"style.css":                 {Data: []byte("")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := New(r, nt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var n notes
+	for _, word := range words {
+		err := g.Generate(context.Background(), &n, &wordlist.Deck{}, &wordlist.Word{Text: word})
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func TestGenerateRecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	cfg := filepath.Join(dir, "dicts.yaml")
+	writeFile(t, cfg, "dictionaries:\n  ecdict:\n    kind: local\n    path: ecdict.csv\n")
+	writeFile(t, filepath.Join(dir, "ecdict.csv"), "word,translation\napple,n. 苹果\n")
+	fixtures := filepath.Join(dir, "fixtures")
+
+	want := notes{{"apple", "apple", "n. 苹果"}, {"pear", "pear", ""}}
+
+	r, err := registry.New(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Record(fixtures)
+	got, err := generate(t, r, "apple", "pear")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("recorded notes = %q, want %q", got, want)
+	}
+
+	// The replay must not read the data file.
+	writeFile(t, filepath.Join(dir, "ecdict.csv"), "word,translation\napple,changed\nbanana,n. 香蕉\n")
+
+	r, err = registry.New(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Replay(fixtures)
+	got, err = generate(t, r, "apple", "pear")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("replayed notes = %q, want %q", got, want)
+	}
+
+	if _, err = generate(t, r, "banana"); !errors.Is(err, dict.ErrNotRecorded) {
+		t.Errorf("replaying an unrecorded word: err = %v, want %v", err, dict.ErrNotRecorded)
+	}
+}
@@ -0,0 +1,228 @@
+package generate
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// mediaFuncs returns the template functions that add media files to the
+// note and return the markup referring to them.
+func (g *Generator) mediaFuncs(ctx context.Context, s *session, media map[string]io.Reader) map[string]any {
+	sound := func(p *dictPronouncer, text string) (string, error) {
+		label := fmt.Sprintf("%s_%s_%s", text, p.Name, p.Accent)
+		if text != s.word {
+			if !p.Caps.Sentences {
+				return "", fmt.Errorf("dictionary %q cannot pronounce sentences", p.Name)
+			}
+			label = text
+		}
+
+		snd, err := s.pronounce(ctx, p, text)
+		if err != nil || snd == nil {
+			return "", err
+		}
+		filename := g.mediaFilename(label, snd.data, "."+snd.format)
+		media[filename] = bytes.NewReader(snd.data)
+		return fmt.Sprintf("[sound:%s]", filename), nil
+	}
+
+	funcs := map[string]any{
+		// {{audio "youdao" "uk" .word}}
+		"audio": func(name, accent, text string) (string, error) {
+			if text == "" {
+				return "", nil
+			}
+			p, err := g.pronouncer(name, accent)
+			if err != nil {
+				return "", fmt.Errorf("audio: %w", err)
+			}
+			return sound(p, text)
+		},
+
+		// {{audio_sentence .sentence}} or {{audio_sentence "youdao" "uk" .sentence}}
+		"audio_sentence": func(args ...string) (string, error) {
+			var (
+				p   *dictPronouncer
+				err error
+			)
+			switch len(args) {
+			case 1:
+				p, err = g.sentencePronouncer()
+			case 3:
+				p, err = g.pronouncer(args[0], args[1])
+			default:
+				err = fmt.Errorf("expected 1 or 3 arguments, got %d", len(args))
+			}
+			if err != nil {
+				return "", fmt.Errorf("audio_sentence: %w", err)
+			}
+
+			text := strings.TrimSpace(args[len(args)-1])
+			if text == "" {
+				return "", nil
+			}
+			return sound(p, text)
+		},
+
+		// {{image .url}}
+		"image": func(rawURL string) (template.HTML, error) {
+			if rawURL == "" {
+				return "", nil
+			}
+			img, err := s.images.do(rawURL, func() (*image, error) {
+				return fetchImage(ctx, g.client, rawURL)
+			})
+			if err != nil {
+				return "", fmt.Errorf("image: %w", err)
+			}
+			filename := g.mediaFilename(s.word+"_image", img.data, img.ext)
+			media[filename] = bytes.NewReader(img.data)
+			return template.HTML(fmt.Sprintf(`<img src="%s">`, template.HTMLEscapeString(filename))), nil
+		},
+	}
+
+	for _, p := range g.pronouncers {
+		funcs[dictPronunciation(p.Name, p.Accent)] = func() (string, error) {
+			return sound(p, s.word)
+		}
+	}
+	return funcs
+}
+
+// pronouncer returns the pronouncer for the accent of the named dictionary,
+// loading the dictionary if no template function refers to it.
+func (g *Generator) pronouncer(name, accent string) (*dictPronouncer, error) {
+	for _, p := range g.pronouncers {
+		if p.Name == name && p.Accent == accent {
+			return p, nil
+		}
+	}
+	return g.extra.do(pron{name, accent}, func() (*dictPronouncer, error) {
+		return loadOrNewPronouncer(g.registry, name, accent)
+	})
+}
+
+// sentencePronouncer returns the first pronouncer used by the templates
+// that can pronounce sentences.
+func (g *Generator) sentencePronouncer() (*dictPronouncer, error) {
+	for _, p := range g.pronouncers {
+		if p.Caps.Sentences {
+			return p, nil
+		}
+	}
+	return nil, errors.New(`no pronunciation in the templates can pronounce sentences, specify one as in audio_sentence "youdao" "us" .sentence`)
+}
+
+type image struct {
+	data []byte
+	ext  string // Taken from the URL or the content type.
+}
+
+// fetchImage downloads the image at rawURL with client.
+func fetchImage(ctx context.Context, client *http.Client, rawURL string) (*image, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := path.Ext(u.Path)
+	if ext == "" {
+		ext = imageExt(resp.Header.Get("Content-Type"))
+	}
+	return &image{data: data, ext: ext}, nil
+}
+
+func imageExt(contentType string) string {
+	typ, _, _ := mime.ParseMediaType(contentType)
+	switch typ {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/svg+xml":
+		return ".svg"
+	}
+	if exts, _ := mime.ExtensionsByType(typ); len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+// mediaFilename returns the name of a media file with the given data: a
+// readable prefix derived from label, followed by a hash of the data. Data
+// named before keeps its first name whatever the label, e.g. an image
+// shared by several words, so the same data always gets the same name and
+// is stored once in the collection. Names only contain letters, digits and
+// underscores apart from the extension, so they are safe in Anki's media
+// folder on every platform.
+func (g *Generator) mediaFilename(label string, data []byte, ext string) string {
+	sum := sha1.Sum(data)
+	name, _ := g.media.do(hex.EncodeToString(sum[:])+ext, func() (string, error) {
+		hash := hex.EncodeToString(sum[:8])
+		if prefix := mediaPrefix(label); prefix != "" {
+			return prefix + "_" + hash + ext, nil
+		}
+		return hash + ext, nil
+	})
+	return name
+}
+
+// maxPrefixLen is the maximum number of characters in a media file name
+// prefix, keeping the names well below Anki's limit.
+const maxPrefixLen = 40
+
+func mediaPrefix(label string) string {
+	var b strings.Builder
+	var n int
+	sep := false
+	for _, r := range norm.NFC.String(label) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			sep = b.Len() > 0
+			continue
+		}
+		if sep {
+			if n+2 > maxPrefixLen {
+				break
+			}
+			b.WriteByte('_')
+			n++
+			sep = false
+		}
+		if n+1 > maxPrefixLen {
+			break
+		}
+		b.WriteRune(r)
+		n++
+	}
+	return b.String()
+}
@@ -0,0 +1,48 @@
+package generate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMediaFilename(t *testing.T) {
+	var g Generator
+	run := []byte("ID3 run")
+
+	name := g.mediaFilename("run_youdao_us", run, ".mp3")
+	if !strings.HasPrefix(name, "run_youdao_us_") || !strings.HasSuffix(name, ".mp3") {
+		t.Errorf("mediaFilename = %q, want run_youdao_us_<hash>.mp3", name)
+	}
+
+	// The same data keeps its first name under other labels.
+	for _, label := range []string{"Run_youdao_us", "running_image", ""} {
+		if got := g.mediaFilename(label, run, ".mp3"); got != name {
+			t.Errorf("mediaFilename(%q) = %q, want %q", label, got, name)
+		}
+	}
+
+	if got := g.mediaFilename("run_youdao_us", []byte("ID3 ran"), ".mp3"); got == name {
+		t.Errorf("mediaFilename of other data = %q, want another name", got)
+	}
+	if got := g.mediaFilename("run_youdao_us", run, ".wav"); got == name {
+		t.Errorf("mediaFilename with another extension = %q, want another name", got)
+	}
+}
+
+func TestMediaPrefix(t *testing.T) {
+	tests := []struct {
+		label, want string
+	}{
+		{"run_youdao_us", "run_youdao_us"},
+		{"give up", "give_up"},
+		{"../a/b: c?", "a_b_c"},
+		{"café", "café"},
+		{"!!!", ""},
+		{strings.Repeat("a", 50), strings.Repeat("a", maxPrefixLen)},
+	}
+	for _, tt := range tests {
+		if got := mediaPrefix(tt.label); got != tt.want {
+			t.Errorf("mediaPrefix(%q) = %q, want %q", tt.label, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package generate
+
+import (
+	"sync"
+)
+
+// memo memoizes the results of function calls by key. Concurrent calls with
+// the same key wait for the first one to finish and share its result.
+type memo[K comparable, V any] struct {
+	mu    sync.Mutex
+	calls map[K]*memoCall[V]
+}
+
+type memoCall[V any] struct {
+	once sync.Once
+	val  V
+	err  error
+}
+
+func (m *memo[K, V]) do(key K, fn func() (V, error)) (V, error) {
+	m.mu.Lock()
+	if m.calls == nil {
+		m.calls = make(map[K]*memoCall[V])
+	}
+	c, ok := m.calls[key]
+	if !ok {
+		c = new(memoCall[V])
+		m.calls[key] = c
+	}
+	m.mu.Unlock()
+
+	c.once.Do(func() {
+		c.val, c.err = fn()
+	})
+	return c.val, c.err
+}
@@ -0,0 +1,103 @@
+package generate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lftk/anki-vocab/internal/dyntmpl"
+)
+
+// fieldDeps returns the names of the fields whose rendered output t uses,
+// as in {{.fields.definitions}}.
+func fieldDeps(t *dyntmpl.Template) []string {
+	var deps []string
+	for _, f := range t.Fields() {
+		if s, ok := strings.CutPrefix(f, "fields."); ok {
+			name, _, _ := strings.Cut(s, ".")
+			deps = append(deps, name)
+		}
+	}
+	return deps
+}
+
+// executionOrder returns the indexes of tmpls in an order where every field
+// comes after the fields it uses. It fails on unknown fields and cycles.
+func executionOrder(tmpls []*dyntmpl.Template) ([]int, error) {
+	index := make(map[string]int, len(tmpls))
+	nodes := make([]int, len(tmpls))
+	for i, t := range tmpls {
+		index[t.Name()] = i
+		nodes[i] = i
+	}
+
+	deps := func(i int) ([]int, error) {
+		var js []int
+		for _, dep := range fieldDeps(tmpls[i]) {
+			j, ok := index[dep]
+			if !ok {
+				return nil, fmt.Errorf("field %q uses unknown field %q", tmpls[i].Name(), dep)
+			}
+			js = append(js, j)
+		}
+		return js, nil
+	}
+	name := func(i int) string { return tmpls[i].Name() }
+	return topoSort("fields", nodes, deps, name)
+}
+
+// checkRequires fails if the dictionaries that queryers require form a cycle.
+func checkRequires(queryers []*dictQueryer) error {
+	deps := func(q *dictQueryer) ([]*dictQueryer, error) { return q.Requires, nil }
+	name := func(q *dictQueryer) string { return q.Name }
+	_, err := topoSort("dictionaries", queryers, deps, name)
+	return err
+}
+
+// topoSort returns nodes in an order where every node comes after the
+// nodes it depends on. It fails if deps fails or if the nodes, named by
+// name and described by what in the error, form a cycle.
+func topoSort[T comparable](what string, nodes []T, deps func(T) ([]T, error), name func(T) string) ([]T, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	var (
+		order []T
+		state = make(map[T]int, len(nodes))
+		path  []string
+		visit func(n T) error
+	)
+	visit = func(n T) error {
+		switch state[n] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("%s form a cycle: %s -> %s", what, strings.Join(path, " -> "), name(n))
+		}
+
+		state[n] = visiting
+		path = append(path, name(n))
+		ds, err := deps(n)
+		if err != nil {
+			return err
+		}
+		for _, d := range ds {
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[n] = visited
+
+		order = append(order, n)
+		return nil
+	}
+
+	for _, n := range nodes {
+		if err := visit(n); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
@@ -0,0 +1,78 @@
+package generate
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/lftk/anki-vocab/internal/dyntmpl"
+)
+
+func parseFields(t *testing.T, fields map[string]string) []*dyntmpl.Template {
+	t.Helper()
+	var names []string
+	for name := range fields {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var tmpls []*dyntmpl.Template
+	for _, name := range names {
+		tmpl, err := dyntmpl.Parse(name, fields[name], nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpls = append(tmpls, tmpl)
+	}
+	return tmpls
+}
+
+func TestExecutionOrder(t *testing.T) {
+	tmpls := parseFields(t, map[string]string{
+		"a": "{{.fields.b}} {{.fields.c}}",
+		"b": "{{.fields.c}}",
+		"c": "{{.word}}",
+	})
+	order, err := executionOrder(tmpls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, i := range order {
+		names = append(names, tmpls[i].Name())
+	}
+	if want := []string{"c", "b", "a"}; !slices.Equal(names, want) {
+		t.Errorf("order = %v, want %v", names, want)
+	}
+}
+
+func TestExecutionOrderErrors(t *testing.T) {
+	tests := []struct {
+		fields map[string]string
+		want   string
+	}{
+		{map[string]string{"a": "{{.fields.a}}"}, "fields form a cycle: a -> a"},
+		{map[string]string{"a": "{{.fields.b}}", "b": "{{.fields.a}}"}, "fields form a cycle: a -> b -> a"},
+		{map[string]string{"a": "{{.fields.x}}"}, `field "a" uses unknown field "x"`},
+	}
+	for _, tt := range tests {
+		_, err := executionOrder(parseFields(t, tt.fields))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("executionOrder(%v) = %v, want %q", tt.fields, err, tt.want)
+		}
+	}
+}
+
+func TestCheckRequires(t *testing.T) {
+	a := &dictQueryer{Name: "a"}
+	b := &dictQueryer{Name: "b", Requires: []*dictQueryer{a}}
+	if err := checkRequires([]*dictQueryer{a, b}); err != nil {
+		t.Fatal(err)
+	}
+
+	a.Requires = []*dictQueryer{b}
+	err := checkRequires([]*dictQueryer{a, b})
+	if want := "dictionaries form a cycle: a -> b -> a"; err == nil || err.Error() != want {
+		t.Errorf("checkRequires = %v, want %q", err, want)
+	}
+}
@@ -0,0 +1,130 @@
+// Package httpclient creates the HTTP clients of the dictionaries and of
+// image downloads, configured in dicts.yaml globally or per dictionary.
+package httpclient
+
+import (
+	"cmp"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+type Config struct {
+	// Timeout limits the time of a request, including reading the
+	// response. If zero, the default of the dictionary is used.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Proxy is the URL of the proxy to use, e.g. "http://proxy:8080" or
+	// "socks5://127.0.0.1:1080". If empty, the proxy is taken from the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+	Proxy string `yaml:"proxy"`
+
+	// CACert is a PEM file of certificates trusted in addition to those of
+	// the system, e.g. of a corporate proxy.
+	CACert string `yaml:"ca_cert"`
+
+	// InsecureSkipVerify disables the verification of server certificates,
+	// for local stand-ins of services only.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+
+	// Headers are added to every request, replacing those of the same name.
+	Headers map[string]string `yaml:"headers"`
+
+	// BaseURL replaces the scheme, host and path prefix of the service of
+	// a dictionary, e.g. to use a mock server. It cannot be set globally.
+	BaseURL string `yaml:"base_url"`
+}
+
+// Merge returns the config of a dictionary, cfg, completed with the global
+// config c. Headers are merged, those of the dictionary taking precedence.
+// InsecureSkipVerify applies if set in either.
+func (c *Config) Merge(cfg *Config) *Config {
+	headers := maps.Clone(c.Headers)
+	if headers == nil {
+		headers = cfg.Headers
+	} else {
+		maps.Copy(headers, cfg.Headers)
+	}
+	return &Config{
+		Timeout:            cmp.Or(cfg.Timeout, c.Timeout),
+		Proxy:              cmp.Or(cfg.Proxy, c.Proxy),
+		CACert:             cmp.Or(cfg.CACert, c.CACert),
+		InsecureSkipVerify: cfg.InsecureSkipVerify || c.InsecureSkipVerify,
+		Headers:            headers,
+		BaseURL:            cfg.BaseURL,
+	}
+}
+
+func (c *Config) Validate() error {
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative, got %s", c.Timeout)
+	}
+	return nil
+}
+
+// New returns a client configured by cfg, whose requests time out after
+// defaultTimeout unless cfg sets another timeout.
+func New(cfg *Config, defaultTimeout time.Duration) (*http.Client, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.Proxy != "" {
+		u, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy: %w", err)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy %q: expected a URL such as http://host:port", cfg.Proxy)
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+
+	if cfg.CACert != "" || cfg.InsecureSkipVerify {
+		t.TLSClientConfig = &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	}
+	if cfg.CACert != "" {
+		pem, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", cfg.CACert)
+		}
+		t.TLSClientConfig.RootCAs = pool
+	}
+
+	var rt http.RoundTripper = t
+	if len(cfg.Headers) > 0 {
+		rt = &headerTransport{headers: cfg.Headers, base: t}
+	}
+	return &http.Client{
+		Transport: rt,
+		Timeout:   cmp.Or(cfg.Timeout, defaultTimeout),
+	}, nil
+}
+
+// headerTransport adds headers to the requests sent by base.
+type headerTransport struct {
+	headers map[string]string
+	base    http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the request.
+	req = req.Clone(req.Context())
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	return t.base.RoundTrip(req)
+}
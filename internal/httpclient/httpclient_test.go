@@ -0,0 +1,231 @@
+package httpclient
+
+import (
+	"encoding/pem"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMerge(t *testing.T) {
+	global := &Config{
+		Timeout: time.Minute,
+		Proxy:   "http://global:8080",
+		CACert:  "global.pem",
+		Headers: map[string]string{"A": "global", "B": "global"},
+		BaseURL: "http://ignored",
+	}
+	tests := []struct {
+		name   string
+		global *Config
+		cfg    *Config
+		want   *Config
+	}{
+		{
+			name:   "inherited",
+			global: global,
+			cfg:    &Config{},
+			want: &Config{
+				Timeout: time.Minute,
+				Proxy:   "http://global:8080",
+				CACert:  "global.pem",
+				Headers: map[string]string{"A": "global", "B": "global"},
+			},
+		},
+		{
+			name:   "overridden",
+			global: global,
+			cfg: &Config{
+				Timeout: time.Second,
+				Proxy:   "socks5://dict:1080",
+				CACert:  "dict.pem",
+				Headers: map[string]string{"B": "dict", "C": "dict"},
+				BaseURL: "http://dict",
+			},
+			want: &Config{
+				Timeout: time.Second,
+				Proxy:   "socks5://dict:1080",
+				CACert:  "dict.pem",
+				Headers: map[string]string{"A": "global", "B": "dict", "C": "dict"},
+				BaseURL: "http://dict",
+			},
+		},
+		{
+			name:   "no global headers",
+			global: &Config{},
+			cfg:    &Config{Headers: map[string]string{"C": "dict"}},
+			want:   &Config{Headers: map[string]string{"C": "dict"}},
+		},
+		{
+			name:   "insecure globally",
+			global: &Config{InsecureSkipVerify: true},
+			cfg:    &Config{},
+			want:   &Config{InsecureSkipVerify: true},
+		},
+		{
+			name:   "insecure per dictionary",
+			global: &Config{},
+			cfg:    &Config{InsecureSkipVerify: true},
+			want:   &Config{InsecureSkipVerify: true},
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.global.Merge(tt.cfg); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Merge() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	// Merging must not modify the global headers.
+	if want := map[string]string{"A": "global", "B": "global"}; !maps.Equal(global.Headers, want) {
+		t.Errorf("global headers = %v, want %v", global.Headers, want)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(empty, []byte("no certificates here"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		cfg  *Config
+		want string
+	}{
+		{&Config{Timeout: -time.Second}, "timeout must not be negative"},
+		{&Config{Proxy: "127.0.0.1:8080"}, "invalid proxy"},
+		{&Config{Proxy: "proxy:8080"}, "invalid proxy"},
+		{&Config{Proxy: "http://"}, "invalid proxy"},
+		{&Config{Proxy: "http://%zz"}, "invalid proxy"},
+		{&Config{CACert: filepath.Join(t.TempDir(), "missing.pem")}, "missing.pem"},
+		{&Config{CACert: empty}, "no certificates in"},
+	}
+	for _, tt := range tests {
+		_, err := New(tt.cfg, time.Second)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("New(%+v) error = %v, want %q", tt.cfg, err, tt.want)
+		}
+	}
+}
+
+func TestNewTimeout(t *testing.T) {
+	for _, tt := range []struct {
+		timeout time.Duration
+		want    time.Duration
+	}{{0, time.Minute}, {time.Second, time.Second}} {
+		c, err := New(&Config{Timeout: tt.timeout}, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Timeout != tt.want {
+			t.Errorf("timeout %s: client timeout = %s, want %s", tt.timeout, c.Timeout, tt.want)
+		}
+	}
+}
+
+func get(t *testing.T, c *http.Client, url string) (string, error) {
+	t.Helper()
+	resp, err := c.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	return string(b), err
+}
+
+func TestNewCACert(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	cert := filepath.Join(t.TempDir(), "ca.pem")
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(cert, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		cfg *Config
+		ok  bool
+	}{
+		{&Config{}, false},
+		{&Config{CACert: cert}, true},
+		{&Config{InsecureSkipVerify: true}, true},
+	}
+	for _, tt := range tests {
+		c, err := New(tt.cfg, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := get(t, c, srv.URL)
+		if tt.ok && (err != nil || body != "ok") {
+			t.Errorf("%+v: got %q, %v, want ok", tt.cfg, body, err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("%+v: request to an untrusted server succeeded", tt.cfg)
+		}
+	}
+}
+
+func TestNewHeaders(t *testing.T) {
+	got := make(chan http.Header, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got <- r.Header.Clone()
+	}))
+	defer srv.Close()
+
+	c, err := New(&Config{Headers: map[string]string{"User-Agent": "test", "X-Token": "secret"}}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("User-Agent", "replaced")
+	req.Header.Set("X-Kept", "kept")
+
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	header := <-got
+	for key, want := range map[string]string{"User-Agent": "test", "X-Token": "secret", "X-Kept": "kept"} {
+		if v := header.Get(key); v != want {
+			t.Errorf("header %s = %q, want %q", key, v, want)
+		}
+	}
+	if v := req.Header.Get("User-Agent"); v != "replaced" {
+		t.Errorf("the request was modified: User-Agent = %q", v)
+	}
+}
+
+func TestNewProxy(t *testing.T) {
+	hosts := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts <- r.URL.Host
+		io.WriteString(w, "proxied")
+	}))
+	defer proxy.Close()
+
+	c, err := New(&Config{Proxy: proxy.URL}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := get(t, c, "http://dict.example/query")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host := <-hosts; body != "proxied" || host != "dict.example" {
+		t.Errorf("got %q for host %q, want the request sent through the proxy", body, host)
+	}
+}
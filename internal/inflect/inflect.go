@@ -0,0 +1,284 @@
+// Package inflect generates the inflected forms of English words and finds
+// their base forms, for matching words in text and looking them up in
+// dictionary files.
+package inflect
+
+import (
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/lftk/anki-vocab/internal/utils"
+)
+
+// irregulars maps base forms to their irregular inflections.
+var irregulars = map[string][]string{
+	"be":         {"am", "is", "are", "was", "were", "been", "being"},
+	"have":       {"has", "had", "having"},
+	"do":         {"does", "did", "done", "doing"},
+	"go":         {"goes", "went", "gone", "going"},
+	"arise":      {"arose", "arisen"},
+	"awake":      {"awoke", "awoken"},
+	"bear":       {"bore", "born", "borne"},
+	"beat":       {"beaten"},
+	"become":     {"became"},
+	"begin":      {"began", "begun"},
+	"bend":       {"bent"},
+	"bite":       {"bit", "bitten"},
+	"blow":       {"blew", "blown"},
+	"break":      {"broke", "broken"},
+	"bring":      {"brought"},
+	"build":      {"built"},
+	"burn":       {"burnt"},
+	"buy":        {"bought"},
+	"catch":      {"caught"},
+	"choose":     {"chose", "chosen"},
+	"come":       {"came"},
+	"cost":       {"cost"},
+	"cut":        {"cut"},
+	"deal":       {"dealt"},
+	"dig":        {"dug"},
+	"draw":       {"drew", "drawn"},
+	"dream":      {"dreamt"},
+	"drink":      {"drank", "drunk"},
+	"drive":      {"drove", "driven"},
+	"eat":        {"ate", "eaten"},
+	"fall":       {"fell", "fallen"},
+	"feed":       {"fed"},
+	"feel":       {"felt"},
+	"fight":      {"fought"},
+	"find":       {"found"},
+	"fly":        {"flew", "flown", "flies"},
+	"forget":     {"forgot", "forgotten"},
+	"forgive":    {"forgave", "forgiven"},
+	"freeze":     {"froze", "frozen"},
+	"get":        {"got", "gotten"},
+	"give":       {"gave", "given"},
+	"grow":       {"grew", "grown"},
+	"hang":       {"hung"},
+	"hear":       {"heard"},
+	"hide":       {"hid", "hidden"},
+	"hit":        {"hit"},
+	"hold":       {"held"},
+	"hurt":       {"hurt"},
+	"keep":       {"kept"},
+	"know":       {"knew", "known"},
+	"lay":        {"laid"},
+	"lead":       {"led"},
+	"learn":      {"learnt"},
+	"leave":      {"left"},
+	"lend":       {"lent"},
+	"let":        {"let"},
+	"lie":        {"lay", "lain", "lying"},
+	"light":      {"lit"},
+	"lose":       {"lost"},
+	"make":       {"made"},
+	"mean":       {"meant"},
+	"meet":       {"met"},
+	"pay":        {"paid"},
+	"put":        {"put"},
+	"quit":       {"quit"},
+	"read":       {"read"},
+	"ride":       {"rode", "ridden"},
+	"ring":       {"rang", "rung"},
+	"rise":       {"rose", "risen"},
+	"run":        {"ran"},
+	"say":        {"said"},
+	"see":        {"saw", "seen"},
+	"seek":       {"sought"},
+	"sell":       {"sold"},
+	"send":       {"sent"},
+	"set":        {"set"},
+	"shake":      {"shook", "shaken"},
+	"shine":      {"shone"},
+	"shoot":      {"shot"},
+	"show":       {"shown"},
+	"shut":       {"shut"},
+	"sing":       {"sang", "sung"},
+	"sink":       {"sank", "sunk"},
+	"sit":        {"sat"},
+	"sleep":      {"slept"},
+	"slide":      {"slid"},
+	"speak":      {"spoke", "spoken"},
+	"spend":      {"spent"},
+	"spread":     {"spread"},
+	"stand":      {"stood"},
+	"steal":      {"stole", "stolen"},
+	"stick":      {"stuck"},
+	"strike":     {"struck"},
+	"swear":      {"swore", "sworn"},
+	"swim":       {"swam", "swum"},
+	"take":       {"took", "taken"},
+	"teach":      {"taught"},
+	"tear":       {"tore", "torn"},
+	"tell":       {"told"},
+	"think":      {"thought"},
+	"throw":      {"threw", "thrown"},
+	"understand": {"understood"},
+	"wake":       {"woke", "woken"},
+	"wear":       {"wore", "worn"},
+	"win":        {"won"},
+	"write":      {"wrote", "written"},
+	"child":      {"children"},
+	"foot":       {"feet"},
+	"goose":      {"geese"},
+	"man":        {"men"},
+	"mouse":      {"mice"},
+	"person":     {"people"},
+	"tooth":      {"teeth"},
+	"woman":      {"women"},
+	"good":       {"better", "best"},
+	"bad":        {"worse", "worst"},
+	"far":        {"farther", "further", "farthest", "furthest"},
+	"little":     {"less", "least"},
+	"many":       {"more", "most"},
+	"much":       {"more", "most"},
+}
+
+// Forms returns word followed by its likely inflected forms: plurals,
+// verb forms and comparatives, including common irregular ones. Forms are
+// over-generated, which is harmless when used for matching. For a phrase,
+// only its first word is inflected, e.g. "gave up" for "give up".
+func Forms(word string) []string {
+	word = strings.TrimSpace(word)
+	head, rest, ok := strings.Cut(word, " ")
+	if ok {
+		rest = " " + rest
+	}
+
+	base := strings.ToLower(head)
+	forms := []string{base}
+	forms = append(forms, irregulars[base]...)
+	if isWord(base) {
+		forms = append(forms, suffixed(base, "s")...)
+		forms = append(forms, suffixed(base, "ed")...)
+		forms = append(forms, suffixed(base, "ing")...)
+		forms = append(forms, suffixed(base, "er")...)
+		forms = append(forms, suffixed(base, "est")...)
+	}
+
+	forms = utils.SliceUnique(forms)
+	for i := range forms {
+		forms[i] += rest
+	}
+	forms[0] = word
+	return forms
+}
+
+// Lemmas returns the likely base forms of an inflected word, the reverse
+// of Forms: "run" for "ran" or "running", "city" for "cities". Only the
+// bases that Forms inflects back into word are returned, and none if word
+// is not inflected. As in Forms, only the first word of a phrase counts.
+func Lemmas(word string) []string {
+	word = strings.TrimSpace(word)
+	head, rest, ok := strings.Cut(word, " ")
+	if ok {
+		rest = " " + rest
+	}
+	w := strings.ToLower(head)
+
+	var candidates []string
+	for _, base := range slices.Sorted(maps.Keys(irregulars)) {
+		if slices.Contains(irregulars[base], w) {
+			candidates = append(candidates, base)
+		}
+	}
+	if isWord(w) {
+		// Shorter suffixes first, so that "used" is "use" rather than "us".
+		for _, suffix := range []string{"s", "es", "d", "ed", "ing", "r", "er", "st", "est"} {
+			stem, ok := strings.CutSuffix(w, suffix)
+			if !ok || len(stem) < 2 {
+				continue
+			}
+			n := len(stem)
+			candidates = append(candidates, stem+"e", stem)
+			switch {
+			case stem[n-1] == 'i':
+				candidates = append(candidates, stem[:n-1]+"y")
+			case stem[n-1] == 'y':
+				candidates = append(candidates, stem[:n-1]+"ie")
+			case stem[n-1] == 'v':
+				candidates = append(candidates, stem[:n-1]+"f", stem[:n-1]+"fe")
+			case stem[n-1] == stem[n-2]:
+				candidates = append(candidates, stem[:n-1])
+			}
+		}
+	}
+
+	var lemmas []string
+	for _, c := range utils.SliceUnique(candidates) {
+		if c != w && slices.Contains(Forms(c)[1:], w) {
+			lemmas = append(lemmas, c+rest)
+		}
+	}
+	return lemmas
+}
+
+// suffixed applies the English spelling rules for adding suffix to w.
+func suffixed(w, suffix string) []string {
+	n := len(w)
+	last := w[n-1]
+
+	if suffix == "s" {
+		switch {
+		case strings.HasSuffix(w, "s"), strings.HasSuffix(w, "x"), strings.HasSuffix(w, "z"),
+			strings.HasSuffix(w, "ch"), strings.HasSuffix(w, "sh"):
+			return []string{w + "es"}
+		case last == 'y' && n > 1 && !isVowel(w[n-2]):
+			return []string{w[:n-1] + "ies"}
+		case last == 'o':
+			return []string{w + "s", w + "es"}
+		case strings.HasSuffix(w, "f"):
+			return []string{w + "s", w[:n-1] + "ves"}
+		case strings.HasSuffix(w, "fe"):
+			return []string{w + "s", w[:n-2] + "ves"}
+		}
+		return []string{w + "s"}
+	}
+
+	switch {
+	case suffix == "ing" && strings.HasSuffix(w, "ie"):
+		return []string{w[:n-2] + "ying"}
+	case last == 'e' && suffix == "ing":
+		if strings.HasSuffix(w, "ee") || strings.HasSuffix(w, "ye") || strings.HasSuffix(w, "oe") {
+			return []string{w + suffix}
+		}
+		return []string{w[:n-1] + suffix}
+	case last == 'e':
+		return []string{w + suffix[1:]}
+	case last == 'y' && n > 1 && !isVowel(w[n-2]) && suffix != "ing":
+		return []string{w[:n-1] + "i" + suffix}
+	case isCVC(w):
+		// Doubling depends on stress, e.g. "stopped" but "visited", so
+		// both spellings are generated.
+		return []string{w + string(last) + suffix, w + suffix}
+	}
+	return []string{w + suffix}
+}
+
+func isVowel(c byte) bool {
+	return strings.IndexByte("aeiou", c) >= 0
+}
+
+// isCVC reports whether w ends with consonant-vowel-consonant, where the
+// final consonant is not w, x or y.
+func isCVC(w string) bool {
+	n := len(w)
+	if n < 3 {
+		return false
+	}
+	c1, v, c2 := w[n-3], w[n-2], w[n-1]
+	return !isVowel(c1) && isVowel(v) && !isVowel(c2) && strings.IndexByte("wxy", c2) < 0
+}
+
+func isWord(w string) bool {
+	if w == "" {
+		return false
+	}
+	for i := 0; i < len(w); i++ {
+		if w[i] < 'a' || w[i] > 'z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package inflect
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestForms(t *testing.T) {
+	tests := []struct {
+		word string
+		want []string
+	}{
+		{"run", []string{"running", "runs", "ran"}},
+		{"city", []string{"cities"}},
+		{"stop", []string{"stopped", "stopping"}},
+		{"make", []string{"made", "making", "makes"}},
+		{"lie", []string{"lying", "lay"}},
+		{"give up", []string{"gave up", "gives up"}},
+	}
+	for _, tt := range tests {
+		forms := Forms(tt.word)
+		if forms[0] != tt.word {
+			t.Errorf("Forms(%q)[0] = %q, want the word", tt.word, forms[0])
+		}
+		for _, w := range tt.want {
+			if !slices.Contains(forms, w) {
+				t.Errorf("Forms(%q) = %v, missing %q", tt.word, forms, w)
+			}
+		}
+	}
+}
+
+func TestLemmas(t *testing.T) {
+	tests := []struct {
+		word string
+		want []string
+	}{
+		{"ran", []string{"run"}},
+		{"running", []string{"run"}},
+		{"cities", []string{"city"}},
+		{"used", []string{"use"}},
+		{"gave up", []string{"give up"}},
+		{"Children", []string{"child"}},
+	}
+	for _, tt := range tests {
+		lemmas := Lemmas(tt.word)
+		for _, w := range tt.want {
+			if !slices.Contains(lemmas, w) {
+				t.Errorf("Lemmas(%q) = %v, missing %q", tt.word, lemmas, w)
+			}
+		}
+	}
+
+	for _, word := range []string{"run", "apple", "", "e-mail"} {
+		if lemmas := Lemmas(word); len(lemmas) != 0 {
+			t.Errorf("Lemmas(%q) = %v, want none", word, lemmas)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+// Package jsonschema validates JSON values against a subset of JSON Schema:
+// type, enum, properties, required, additionalProperties, items, minItems,
+// maxItems, minLength and maxLength.
+package jsonschema
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+type Schema struct {
+	Type                 Types              `json:"type,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+}
+
+// Types is the "type" keyword, either a single type or a list of types.
+type Types []string
+
+func (t *Types) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*t = Types{s}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(t))
+}
+
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// Parse parses a schema from its JSON encoding.
+func Parse(b []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	return &s, nil
+}
+
+// Infer returns a schema that requires every property of the example and
+// the types of its values, e.g. for {"a": "x", "b": [1]}, that "a" is a
+// string and "b" an array of numbers.
+func Infer(example any) *Schema {
+	switch v := example.(type) {
+	case map[string]any:
+		s := &Schema{Type: Types{"object"}, Properties: make(map[string]*Schema, len(v))}
+		for key, val := range v {
+			s.Properties[key] = Infer(val)
+			s.Required = append(s.Required, key)
+		}
+		slices.Sort(s.Required)
+		return s
+	case []any:
+		s := &Schema{Type: Types{"array"}}
+		if len(v) > 0 {
+			s.Items = Infer(v[0])
+		}
+		return s
+	case string:
+		return &Schema{Type: Types{"string"}}
+	case float64:
+		return &Schema{Type: Types{"number"}}
+	case bool:
+		return &Schema{Type: Types{"boolean"}}
+	}
+	return &Schema{}
+}
+
+// Error is a violation of the schema by the value at Path, a JSON pointer.
+type Error struct {
+	Path    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", cmp.Or(e.Path, "/"), e.Message)
+}
+
+// Validate validates the JSON document b, returning all violations.
+func (s *Schema) Validate(b []byte) ([]*Error, error) {
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return s.validate("", v, nil), nil
+}
+
+func (s *Schema) validate(path string, v any, errs []*Error) []*Error {
+	if s == nil {
+		return errs
+	}
+	fail := func(format string, args ...any) {
+		errs = append(errs, &Error{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(s.Type) > 0 && !slices.ContainsFunc(s.Type, func(t string) bool { return hasType(v, t) }) {
+		fail("expected %s, got %s", strings.Join(s.Type, " or "), typeOf(v))
+		return errs
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return reflect.DeepEqual(e, v) }) {
+		fail("value %v is not one of %v", v, s.Enum)
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		for _, key := range s.Required {
+			if _, ok := v[key]; !ok {
+				fail("missing property %q", key)
+			}
+		}
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			sub := path + "/" + escape(key)
+			if ps, ok := s.Properties[key]; ok {
+				errs = ps.validate(sub, v[key], errs)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				fail("unexpected property %q", key)
+			}
+		}
+
+	case []any:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("expected at least %d items, got %d", *s.MinItems, len(v))
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("expected at most %d items, got %d", *s.MaxItems, len(v))
+		}
+		for i, elem := range v {
+			errs = s.Items.validate(fmt.Sprintf("%s/%d", path, i), elem, errs)
+		}
+
+	case string:
+		n := len([]rune(v))
+		if s.MinLength != nil && n < *s.MinLength {
+			fail("expected at least %d characters, got %d", *s.MinLength, n)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("expected at most %d characters, got %d", *s.MaxLength, n)
+		}
+	}
+	return errs
+}
+
+func hasType(v any, typ string) bool {
+	switch typ {
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	}
+	return typeOf(v) == typ
+}
+
+func typeOf(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// escape escapes a property name for use in a JSON pointer.
+func escape(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
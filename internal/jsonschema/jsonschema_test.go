@@ -0,0 +1,185 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	schema, err := Parse([]byte(`{
+		"type": "object",
+		"required": ["word", "story"],
+		"additionalProperties": false,
+		"properties": {
+			"word": {"type": "string", "minLength": 1, "maxLength": 5},
+			"level": {"type": "integer", "enum": [1, 2, 3]},
+			"score": {"type": ["number", "null"]},
+			"tags": {"type": "array", "minItems": 1, "maxItems": 2, "items": {"type": "string"}},
+			"story": {
+				"type": "object",
+				"required": ["english"],
+				"properties": {"english": {"type": "string"}}
+			},
+			"a/b~c": {"type": "boolean"}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		doc  string
+		want []string
+	}{
+		{
+			name: "valid",
+			doc:  `{"word": "apple", "level": 2, "score": null, "tags": ["a"], "story": {"english": "x"}, "a/b~c": true}`,
+		},
+		{
+			name: "not an object",
+			doc:  `"apple"`,
+			want: []string{"/: expected object, got string"},
+		},
+		{
+			name: "missing and unexpected",
+			doc:  `{"story": {}, "extra": 1}`,
+			want: []string{
+				`/: missing property "word"`,
+				`/: unexpected property "extra"`,
+				`/story: missing property "english"`,
+			},
+		},
+		{
+			name: "wrong types",
+			doc:  `{"word": 1, "level": 1.5, "score": "high", "story": "once upon a time"}`,
+			want: []string{
+				"/level: expected integer, got number",
+				"/score: expected number or null, got string",
+				"/story: expected object, got string",
+				"/word: expected string, got number",
+			},
+		},
+		{
+			name: "enum and lengths",
+			doc:  `{"word": "", "level": 4, "tags": [], "story": {"english": "x"}}`,
+			want: []string{
+				"/level: value 4 is not one of [1 2 3]",
+				"/tags: expected at least 1 items, got 0",
+				"/word: expected at least 1 characters, got 0",
+			},
+		},
+		{
+			name: "items",
+			doc:  `{"word": "苹果苹果苹果", "tags": ["a", 1, "c"], "story": {"english": "x"}, "a/b~c": "yes"}`,
+			want: []string{
+				"/a~1b~0c: expected boolean, got string",
+				"/tags: expected at most 2 items, got 3",
+				"/tags/1: expected string, got number",
+				"/word: expected at most 5 characters, got 6",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs, err := schema.Validate([]byte(tt.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range errs {
+				got = append(got, e.Error())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Validate() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := schema.Validate([]byte(`{"word":`)); err == nil {
+		t.Error("Validate() of invalid JSON succeeded")
+	}
+}
+
+func TestInfer(t *testing.T) {
+	var example any
+	err := json.Unmarshal([]byte(`{
+		"word": "apple",
+		"count": 1,
+		"ok": true,
+		"story": {"english": "x", "chinese": "y"},
+		"tags": ["a"],
+		"empty": [],
+		"nothing": null
+	}`), &example)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := Infer(example)
+	want := &Schema{
+		Type:     Types{"object"},
+		Required: []string{"count", "empty", "nothing", "ok", "story", "tags", "word"},
+		Properties: map[string]*Schema{
+			"word":  {Type: Types{"string"}},
+			"count": {Type: Types{"number"}},
+			"ok":    {Type: Types{"boolean"}},
+			"story": {
+				Type:     Types{"object"},
+				Required: []string{"chinese", "english"},
+				Properties: map[string]*Schema{
+					"english": {Type: Types{"string"}},
+					"chinese": {Type: Types{"string"}},
+				},
+			},
+			"tags":    {Type: Types{"array"}, Items: &Schema{Type: Types{"string"}}},
+			"empty":   {Type: Types{"array"}},
+			"nothing": {},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		gb, _ := json.Marshal(got)
+		wb, _ := json.Marshal(want)
+		t.Errorf("Infer() = %s, want %s", gb, wb)
+	}
+
+	// The example matches its own schema, a different shape does not.
+	b, _ := json.Marshal(example)
+	if errs, err := got.Validate(b); err != nil || len(errs) > 0 {
+		t.Errorf("example does not match its schema: %v %v", errs, err)
+	}
+	if errs, _ := got.Validate([]byte(`{"word": "apple"}`)); len(errs) == 0 {
+		t.Error("object missing properties matches the schema")
+	}
+}
+
+func TestTypes(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want Types
+	}{
+		{`"string"`, Types{"string"}},
+		{`["string", "null"]`, Types{"string", "null"}},
+	} {
+		var got Types
+		if err := json.Unmarshal([]byte(tt.in), &got); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("unmarshal %s = %v, want %v", tt.in, got, tt.want)
+		}
+		b, err := json.Marshal(got)
+		if err != nil || string(b) != compact(tt.in) {
+			t.Errorf("marshal %v = %s, want %s", got, b, tt.in)
+		}
+	}
+}
+
+func compact(s string) string {
+	var v any
+	_ = json.Unmarshal([]byte(s), &v)
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -1,11 +1,16 @@
 package notetype
 
 import (
+	"errors"
+	"fmt"
 	"io/fs"
 	"path"
 	"strings"
 
 	"github.com/lftk/anki"
+	"gopkg.in/yaml.v3"
+
+	"github.com/lftk/anki-vocab/internal/audio"
 )
 
 type Field struct {
@@ -19,11 +24,19 @@ type Template struct {
 	Back  string
 }
 
+// Partial is a named template shared by all fields.
+type Partial struct {
+	Name     string
+	Template string
+}
+
 type Notetype struct {
 	name      string
 	fields    []*Field
+	partials  []*Partial
 	templates []*Template
 	style     string
+	audio     *audio.Config
 }
 
 func Load(name string, fsys fs.FS) (*Notetype, error) {
@@ -32,6 +45,11 @@ func Load(name string, fsys fs.FS) (*Notetype, error) {
 		return nil, err
 	}
 
+	partials, err := loadPartials(fsys)
+	if err != nil {
+		return nil, err
+	}
+
 	templates, err := loadTemplates(fsys)
 	if err != nil {
 		return nil, err
@@ -42,11 +60,18 @@ func Load(name string, fsys fs.FS) (*Notetype, error) {
 		return nil, err
 	}
 
+	audio, err := loadAudio(fsys)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Notetype{
 		name:      name,
 		fields:    fields,
+		partials:  partials,
 		templates: templates,
 		style:     style,
+		audio:     audio,
 	}, nil
 }
 
@@ -58,6 +83,10 @@ func (nt *Notetype) Fields() []*Field {
 	return nt.fields
 }
 
+func (nt *Notetype) Partials() []*Partial {
+	return nt.partials
+}
+
 func (nt *Notetype) Templates() []*Template {
 	return nt.templates
 }
@@ -66,6 +95,12 @@ func (nt *Notetype) Style() string {
 	return nt.style
 }
 
+// Audio returns the audio processing configuration, or nil if the audio
+// files are used as they are.
+func (nt *Notetype) Audio() *audio.Config {
+	return nt.audio
+}
+
 func (nt *Notetype) ToAnki() *anki.Notetype {
 	fields := make([]*anki.Field, 0, len(nt.fields)+1)
 	fields = append(fields, anki.NewField("word"))
@@ -117,6 +152,41 @@ func loadFields(fsys fs.FS) ([]*Field, error) {
 	return fields, nil
 }
 
+// loadPartials loads the optional "partials" directory.
+func loadPartials(fsys fs.FS) ([]*Partial, error) {
+	entries, err := fs.ReadDir(fsys, "partials")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var partials []*Partial
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		filename := entry.Name()
+		if !strings.HasSuffix(filename, ".tmpl") {
+			continue
+		}
+
+		name := strings.TrimSuffix(filename, ".tmpl")
+		tmpl, err := fs.ReadFile(fsys, path.Join("partials", filename))
+		if err != nil {
+			return nil, err
+		}
+
+		partials = append(partials, &Partial{
+			Name:     name,
+			Template: string(tmpl),
+		})
+	}
+	return partials, nil
+}
+
 func loadTemplates(fsys fs.FS) ([]*Template, error) {
 	entries, err := fs.ReadDir(fsys, "templates")
 	if err != nil {
@@ -159,3 +229,23 @@ func loadStyle(fsys fs.FS) (string, error) {
 	}
 	return string(b), nil
 }
+
+// loadAudio loads the optional "audio.yaml" file.
+func loadAudio(fsys fs.FS) (*audio.Config, error) {
+	b, err := fs.ReadFile(fsys, "audio.yaml")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg audio.Config
+	if err = yaml.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("audio.yaml: %w", err)
+	}
+	if err = cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("audio.yaml: %w", err)
+	}
+	return &cfg, nil
+}
@@ -1,20 +1,44 @@
 package registry
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 
 	"github.com/lftk/anki-vocab/internal/dict"
+	"github.com/lftk/anki-vocab/internal/dict/fixture"
+	"github.com/lftk/anki-vocab/internal/dict/local"
+	"github.com/lftk/anki-vocab/internal/dict/mdict"
+	"github.com/lftk/anki-vocab/internal/dict/stardict"
+	"github.com/lftk/anki-vocab/internal/dict/tts"
 	"github.com/lftk/anki-vocab/internal/dict/volcengine"
 	"github.com/lftk/anki-vocab/internal/dict/youdao"
+	"github.com/lftk/anki-vocab/internal/httpclient"
 )
 
 type config struct {
 	Youdao     youdao.Config     `yaml:"youdao"`
 	Volcengine volcengine.Config `yaml:"volcengine"`
+
+	// Fallbacks maps virtual dictionary names to chains of dictionaries,
+	// see newFallback.
+	Fallbacks map[string][]string `yaml:"fallbacks"`
+
+	// Dictionaries maps the names of more dictionaries to their configs,
+	// whose "kind" field selects one of kinds, see newKind.
+	Dictionaries map[string]yaml.Node `yaml:"dictionaries"`
+
+	// HTTP configures the HTTP clients of all dictionaries, which can
+	// override it in their own http section.
+	HTTP httpclient.Config `yaml:"http"`
+
+	// dir is the directory of the config file, which relative paths in
+	// the config are relative to.
+	dir string
 }
 
 func loadConfig(path string) (*config, error) {
@@ -26,13 +50,45 @@ func loadConfig(path string) (*config, error) {
 	if err = yaml.Unmarshal(b, &cfg); err != nil {
 		return nil, err
 	}
+	for name := range cfg.Dictionaries {
+		if _, ok := dicts[name]; ok {
+			return nil, fmt.Errorf("dictionary %q is built in", name)
+		}
+		if _, ok := cfg.Fallbacks[name]; ok {
+			return nil, fmt.Errorf("dictionary %q is also a fallback chain", name)
+		}
+	}
+	if cfg.HTTP.BaseURL != "" {
+		return nil, errors.New("http: base_url can only be set per dictionary")
+	}
+	cfg.dir = filepath.Dir(path)
 	return &cfg, nil
 }
 
+// httpConfig returns the HTTP config of a dictionary, completed with the
+// global one.
+func (cfg *config) httpConfig(c *httpclient.Config) *httpclient.Config {
+	merged := cfg.HTTP.Merge(c)
+	merged.CACert = cfg.path(merged.CACert)
+	return merged
+}
+
+// path resolves a path of the config.
+func (cfg *config) path(p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(cfg.dir, p)
+}
+
 type Registry struct {
-	dicts map[string]*dict.Dict
-	cache string
-	cfg   *config
+	dicts   map[string]*dict.Dict
+	loading map[string]bool
+	cache   string
+	cfg     *config
+
+	fixtures string // Directory of recorded results, see Record and Replay.
+	replay   bool
 }
 
 func New(cfgPath, cacheDir string) (*Registry, error) {
@@ -41,12 +97,33 @@ func New(cfgPath, cacheDir string) (*Registry, error) {
 		return nil, err
 	}
 	return &Registry{
-		dicts: make(map[string]*dict.Dict),
-		cache: cacheDir,
-		cfg:   cfg,
+		dicts:   make(map[string]*dict.Dict),
+		loading: make(map[string]bool),
+		cache:   cacheDir,
+		cfg:     cfg,
 	}, nil
 }
 
+// HTTPConfig returns the global HTTP config, for requests not made by a
+// dictionary, such as downloading images.
+func (r *Registry) HTTPConfig() *httpclient.Config {
+	return r.cfg.httpConfig(&httpclient.Config{})
+}
+
+// Record makes the dictionaries created afterwards store the results of
+// their queries and pronunciations in dir, in a sub-directory per
+// dictionary, for Replay to return later.
+func (r *Registry) Record(dir string) {
+	r.fixtures, r.replay = dir, false
+}
+
+// Replay makes the dictionaries created afterwards return the results
+// recorded in dir by Record instead of querying anything, failing with
+// dict.ErrNotRecorded for those missing.
+func (r *Registry) Replay(dir string) {
+	r.fixtures, r.replay = dir, true
+}
+
 func (r *Registry) LoadOrNew(name string) (*dict.Dict, error) {
 	if d, ok := r.dicts[name]; ok {
 		return d, nil
@@ -59,12 +136,31 @@ func (r *Registry) LoadOrNew(name string) (*dict.Dict, error) {
 }
 
 func (r *Registry) New(name string) (*dict.Dict, error) {
+	if chain, ok := r.cfg.Fallbacks[name]; ok {
+		return r.newFallback(name, chain)
+	}
+	if node, ok := r.cfg.Dictionaries[name]; ok {
+		return r.newKind(name, &node)
+	}
+
 	fn, ok := dicts[name]
 	if !ok {
 		return nil, fmt.Errorf("unknown dictionary: %q", name)
 	}
-	d := fn(r.cfg)
-	if r.cache != "" {
+	d, err := fn(r.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("dictionary %q: %w", name, err)
+	}
+	if d, err = r.cached(name, d); err != nil {
+		return nil, err
+	}
+	return r.recorded(name, d)
+}
+
+// cached wraps the queryer and pronouncer of d with caches, if enabled.
+// Replayed dictionaries are never queried, so they need no cache.
+func (r *Registry) cached(name string, d *dict.Dict) (*dict.Dict, error) {
+	if r.cache != "" && !r.replay {
 		dir := filepath.Join(r.cache, name)
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			return nil, err
@@ -79,11 +175,162 @@ func (r *Registry) New(name string) (*dict.Dict, error) {
 	return d, nil
 }
 
-var dicts = map[string]func(*config) *dict.Dict{
-	"youdao": func(cfg *config) *dict.Dict {
-		return youdao.New(&cfg.Youdao)
+// recorded wraps the queryer and pronouncer of d to record their results
+// or replay them, if enabled.
+func (r *Registry) recorded(name string, d *dict.Dict) (*dict.Dict, error) {
+	if r.fixtures == "" {
+		return d, nil
+	}
+	dir := filepath.Join(r.fixtures, name)
+	if r.replay {
+		if d.Queryer != nil {
+			d.Queryer = dict.ReplayQueryer(dir, d.Queryer)
+		}
+		if d.Pronouncer != nil {
+			d.Pronouncer = dict.ReplayPronouncer(dir)
+		}
+		return d, nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if d.Queryer != nil {
+		d.Queryer = dict.RecordingQueryer(dir, d.Queryer)
+	}
+	if d.Pronouncer != nil {
+		d.Pronouncer = dict.RecordingPronouncer(dir, d.Pronouncer)
+	}
+	return d, nil
+}
+
+// none ends a fallback chain that may yield nothing instead of failing.
+const none = "none"
+
+// newFallback creates the virtual dictionary name from a chain of dictionary
+// names, each optionally followed by the path of a value that must be
+// non-empty for its result to be used, e.g. "youdao.ec.word.trs".
+func (r *Registry) newFallback(name string, chain []string) (*dict.Dict, error) {
+	if r.loading[name] {
+		return nil, fmt.Errorf("fallback chain %q refers to itself", name)
+	}
+	r.loading[name] = true
+	defer delete(r.loading, name)
+
+	var (
+		members  []*dict.FallbackMember
+		optional bool
+	)
+	for i, entry := range chain {
+		if entry == none {
+			if i != len(chain)-1 {
+				return nil, fmt.Errorf("fallback chain %q: %q must be the last entry", name, none)
+			}
+			optional = true
+			break
+		}
+
+		dictName, path, _ := strings.Cut(entry, ".")
+		d, err := r.LoadOrNew(dictName)
+		if err != nil {
+			return nil, fmt.Errorf("fallback chain %q: %w", name, err)
+		}
+
+		m := &dict.FallbackMember{Name: dictName, Dict: d}
+		if path != "" {
+			m.Require = strings.Split(path, ".")
+		}
+		members = append(members, m)
+	}
+	if len(members) == 0 {
+		return nil, fmt.Errorf("fallback chain %q is empty", name)
+	}
+
+	return dict.Fallback(members, optional), nil
+}
+
+// newKind creates the dictionary name from its config node.
+func (r *Registry) newKind(name string, node *yaml.Node) (*dict.Dict, error) {
+	var k struct {
+		Kind string `yaml:"kind"`
+	}
+	if err := node.Decode(&k); err != nil {
+		return nil, fmt.Errorf("dictionary %q: %w", name, err)
+	}
+	fn, ok := kinds[k.Kind]
+	if !ok {
+		return nil, fmt.Errorf("dictionary %q: unknown kind %q", name, k.Kind)
+	}
+	d, err := fn(r, name, node)
+	if err != nil {
+		return nil, fmt.Errorf("dictionary %q: %w", name, err)
+	}
+	if k.Kind == "fixture" {
+		// Fixtures are recordings already.
+		return d, nil
+	}
+	return r.recorded(name, d)
+}
+
+// kinds create the dictionaries configured in the dictionaries section.
+// Dictionaries reading local files are cheap to query again, so unlike the
+// others they are not cached.
+var kinds = map[string]func(r *Registry, name string, node *yaml.Node) (*dict.Dict, error){
+	"local": func(r *Registry, name string, node *yaml.Node) (*dict.Dict, error) {
+		var cfg local.Config
+		if err := node.Decode(&cfg); err != nil {
+			return nil, err
+		}
+		cfg.Path = r.cfg.path(cfg.Path)
+		return local.New(&cfg)
+	},
+	"stardict": func(r *Registry, name string, node *yaml.Node) (*dict.Dict, error) {
+		var cfg stardict.Config
+		if err := node.Decode(&cfg); err != nil {
+			return nil, err
+		}
+		cfg.Path = r.cfg.path(cfg.Path)
+		return stardict.New(&cfg)
+	},
+	"mdict": func(r *Registry, name string, node *yaml.Node) (*dict.Dict, error) {
+		var cfg mdict.Config
+		if err := node.Decode(&cfg); err != nil {
+			return nil, err
+		}
+		cfg.Path = r.cfg.path(cfg.Path)
+		return mdict.New(&cfg)
+	},
+	"fixture": func(r *Registry, name string, node *yaml.Node) (*dict.Dict, error) {
+		var cfg fixture.Config
+		if err := node.Decode(&cfg); err != nil {
+			return nil, err
+		}
+		cfg.Dir = r.cfg.path(cfg.Dir)
+		return fixture.New(&cfg)
+	},
+	"tts": func(r *Registry, name string, node *yaml.Node) (*dict.Dict, error) {
+		var cfg tts.Config
+		if err := node.Decode(&cfg); err != nil {
+			return nil, err
+		}
+		d, err := tts.New(&cfg)
+		if err != nil {
+			return nil, err
+		}
+		// Synthesizing speech is slow, so it is cached.
+		return r.cached(name, d)
+	},
+}
+
+var dicts = map[string]func(*config) (*dict.Dict, error){
+	"youdao": func(cfg *config) (*dict.Dict, error) {
+		c := cfg.Youdao
+		c.HTTP = *cfg.httpConfig(&c.HTTP)
+		return youdao.New(&c)
 	},
-	"volcengine": func(cfg *config) *dict.Dict {
-		return volcengine.New(&cfg.Volcengine)
+	"volcengine": func(cfg *config) (*dict.Dict, error) {
+		c := cfg.Volcengine
+		c.HTTP = *cfg.httpConfig(&c.HTTP)
+		return volcengine.New(&c)
 	},
 }
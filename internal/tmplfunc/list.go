@@ -0,0 +1,188 @@
+package tmplfunc
+
+import (
+	"cmp"
+	"fmt"
+	"html/template"
+	"reflect"
+	"slices"
+)
+
+// toSlice converts any slice or array to []any. A nil value yields a nil slice.
+func toSlice(fn string, data any) ([]any, error) {
+	switch data := data.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		return data, nil
+	}
+	v := reflect.ValueOf(data)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%s: unsupported type %T, expected a slice", fn, data)
+	}
+	s := make([]any, v.Len())
+	for i := range s {
+		s[i] = v.Index(i).Interface()
+	}
+	return s, nil
+}
+
+// field returns the value of key in elem if elem is a map with string keys.
+func field(elem any, key string) (any, bool) {
+	switch m := elem.(type) {
+	case map[string]any:
+		v, ok := m[key]
+		return v, ok
+	case map[string]string:
+		v, ok := m[key]
+		return v, ok
+	}
+	return nil, false
+}
+
+func isEmpty(v any) bool {
+	truth, ok := template.IsTrue(v)
+	return !ok || !truth
+}
+
+func First(data any) (any, error) {
+	s, err := toSlice("first", data)
+	if err != nil || len(s) == 0 {
+		return nil, err
+	}
+	return s[0], nil
+}
+
+func Last(data any) (any, error) {
+	s, err := toSlice("last", data)
+	if err != nil || len(s) == 0 {
+		return nil, err
+	}
+	return s[len(s)-1], nil
+}
+
+// Uniq removes repeated elements, keeping the first occurrence.
+func Uniq(data any) ([]any, error) {
+	s, err := toSlice("uniq", data)
+	if err != nil {
+		return nil, err
+	}
+	var u []any
+	for _, elem := range s {
+		if !slices.ContainsFunc(u, func(e any) bool { return reflect.DeepEqual(e, elem) }) {
+			u = append(u, elem)
+		}
+	}
+	return u, nil
+}
+
+// SortBy sorts a list of objects by the value of key. Numbers are compared
+// numerically, anything else as text. Objects without the key come last.
+func SortBy(key string, data any) ([]any, error) {
+	s, err := toSlice("sortBy", data)
+	if err != nil {
+		return nil, err
+	}
+	s = slices.Clone(s)
+	slices.SortStableFunc(s, func(a, b any) int {
+		va, oka := field(a, key)
+		vb, okb := field(b, key)
+		if !oka || !okb {
+			return -cmp.Compare(btoi(oka), btoi(okb))
+		}
+		na, oka := va.(float64)
+		nb, okb := vb.(float64)
+		if oka && okb {
+			return cmp.Compare(na, nb)
+		}
+		return cmp.Compare(fmt.Sprint(va), fmt.Sprint(vb))
+	})
+	return s, nil
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Filter keeps the objects whose value of key equals value, compared as text.
+func Filter(key string, value any, data any) ([]any, error) {
+	s, err := toSlice("filter", data)
+	if err != nil {
+		return nil, err
+	}
+	want := fmt.Sprint(value)
+	var r []any
+	for _, elem := range s {
+		if v, ok := field(elem, key); ok && fmt.Sprint(v) == want {
+			r = append(r, elem)
+		}
+	}
+	return r, nil
+}
+
+// Pluck returns the values of key of a list of objects.
+func Pluck(key string, data any) ([]any, error) {
+	s, err := toSlice("pluck", data)
+	if err != nil {
+		return nil, err
+	}
+	var r []any
+	for _, elem := range s {
+		if v, ok := field(elem, key); ok {
+			r = append(r, v)
+		}
+	}
+	return r, nil
+}
+
+// Len is like the builtin len, but returns 0 for nil instead of failing.
+func Len(data any) (int, error) {
+	if data == nil {
+		return 0, nil
+	}
+	v := reflect.ValueOf(data)
+	switch v.Kind() {
+	case reflect.Array, reflect.Chan, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len(), nil
+	}
+	return 0, fmt.Errorf("len: unsupported type %T", data)
+}
+
+func Default(def any, data any) any {
+	if isEmpty(data) {
+		return def
+	}
+	return data
+}
+
+// Coalesce returns the first non-empty value.
+func Coalesce(vals ...any) any {
+	for _, v := range vals {
+		if !isEmpty(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+func Dict(pairs ...any) (map[string]any, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("dict: expected an even number of arguments, got %d", len(pairs))
+	}
+	m := make(map[string]any, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict: key %v is not a string", pairs[i])
+		}
+		m[key] = pairs[i+1]
+	}
+	return m, nil
+}
+
+func List(elems ...any) []any {
+	return elems
+}
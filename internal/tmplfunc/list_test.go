@@ -0,0 +1,77 @@
+package tmplfunc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPluck(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    any
+		want    []any
+		wantErr bool
+	}{
+		{"nil", nil, nil, false},
+		{"empty", []any{}, nil, false},
+		{
+			"objects",
+			[]any{
+				map[string]any{"pos": "n.", "tran": "银行"},
+				map[string]any{"pos": "v.", "tran": "存钱"},
+			},
+			[]any{"n.", "v."},
+			false,
+		},
+		{
+			"mixed",
+			[]any{
+				map[string]any{"pos": "n."},
+				"not an object",
+				map[string]any{"tran": "no pos"},
+				nil,
+				map[string]string{"pos": "adj."},
+				map[string]any{"pos": 1.0},
+			},
+			[]any{"n.", "adj.", 1.0},
+			false,
+		},
+		{"typed slice", []map[string]any{{"pos": "n."}}, []any{"n."}, false},
+		{"object", map[string]any{"pos": "n."}, nil, true},
+		{"string", "n.", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Pluck("pos", tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Pluck() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Pluck() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLen(t *testing.T) {
+	tests := []struct {
+		data    any
+		want    int
+		wantErr bool
+	}{
+		{nil, 0, false},
+		{[]any{1.0, "a", nil}, 3, false},
+		{map[string]any{"a": 1.0}, 1, false},
+		{"héllo", 6, false},
+		{1.0, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := Len(tt.data)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Len(%#v) error = %v, wantErr %v", tt.data, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("Len(%#v) = %d, want %d", tt.data, got, tt.want)
+		}
+	}
+}
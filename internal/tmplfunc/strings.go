@@ -0,0 +1,71 @@
+package tmplfunc
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+func Split(sep, s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, sep)
+}
+
+func Replace(old, new, s string) string {
+	return strings.ReplaceAll(s, old, new)
+}
+
+func RegexReplace(pattern, repl, s string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("regexReplace: %w", err)
+	}
+	return re.ReplaceAllString(s, repl), nil
+}
+
+// Truncate shortens s to at most n characters, ending it with "…" if cut.
+func Truncate(n int, s string) string {
+	r := []rune(s)
+	if n < 0 || len(r) <= n {
+		return s
+	}
+	if n == 0 {
+		return ""
+	}
+	return string(r[:n-1]) + "…"
+}
+
+func Title(s string) string {
+	return cases.Title(language.English).String(s)
+}
+
+func Lower(s string) string {
+	return strings.ToLower(s)
+}
+
+func Upper(s string) string {
+	return strings.ToUpper(s)
+}
+
+// ToJSON encodes data as JSON. It is escaped like any other string, so it
+// is safe to use in HTML text, attributes and scripts.
+func ToJSON(data any) (string, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("toJSON: %w", err)
+	}
+	return string(b), nil
+}
+
+// SafeHTML marks s as trusted HTML, so that it is output as is rather than
+// escaped, e.g. the HTML definitions of dictionary files.
+func SafeHTML(s string) template.HTML {
+	return template.HTML(s)
+}
@@ -0,0 +1,56 @@
+package tmplfunc
+
+import "testing"
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		n    int
+		s    string
+		want string
+	}{
+		{5, "", ""},
+		{5, "apple", "apple"},
+		{4, "apple", "app…"},
+		{1, "apple", "…"},
+		{0, "apple", ""},
+		{-1, "apple", "apple"},
+		{3, "苹果公司", "苹果…"},
+		{4, "苹果公司", "苹果公司"},
+	}
+	for _, tt := range tests {
+		if got := Truncate(tt.n, tt.s); got != tt.want {
+			t.Errorf("Truncate(%d, %q) = %q, want %q", tt.n, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    any
+		want    string
+		wantErr bool
+	}{
+		{"nil", nil, "null", false},
+		{"string", `a "b" <c>`, `"a \"b\" \u003cc\u003e"`, false},
+		{"number", 1.5, "1.5", false},
+		{
+			"object",
+			map[string]any{"word": "apple", "trs": []any{map[string]any{"pos": "n."}, nil, true}},
+			`{"trs":[{"pos":"n."},null,true],"word":"apple"}`,
+			false,
+		},
+		{"unsupported", make(chan int), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToJSON(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ToJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ToJSON() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
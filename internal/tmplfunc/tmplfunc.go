@@ -6,7 +6,11 @@ import (
 	"html/template"
 	"reflect"
 	"regexp"
+	"slices"
 	"strings"
+
+	"github.com/lftk/anki-vocab/internal/inflect"
+	"github.com/lftk/anki-vocab/internal/utils"
 )
 
 func Join(sep string, elems any) (string, error) {
@@ -18,7 +22,10 @@ func Join(sep string, elems any) (string, error) {
 	case []any:
 		ss := make([]string, 0, len(elems))
 		for _, elem := range elems {
-			ss = append(ss, fmt.Sprint(elem))
+			// Skip JSON nulls rather than writing "<nil>".
+			if elem != nil {
+				ss = append(ss, fmt.Sprint(elem))
+			}
 		}
 		return strings.Join(ss, sep), nil
 	}
@@ -42,24 +49,98 @@ func Limit(n int, data any) (any, error) {
 	return v.Slice(0, n).Interface(), nil
 }
 
-func Highlight(word string) func(sentence string) template.HTML {
-	return func(sentence string) template.HTML {
-		if sentence != "" {
-			word = strings.TrimSpace(word)
-			re, err := regexp.Compile(
-				fmt.Sprintf(`(?i)\b(%s)\b`, regexp.QuoteMeta(word)),
-			)
-			if err == nil {
-				sentence = re.ReplaceAllString(sentence, `<span class="highlight">$1</span>`)
-			}
+// Highlight returns a function that wraps word in a sentence with
+// <span class="highlight">. Inflected forms of word are highlighted too,
+// both the given forms and those generated by inflect.Forms, and the words
+// of a phrase may be separated by any whitespace. The CSS class can be set
+// by an optional first argument, as in {{.sentence | highlight_word "mark"}}.
+func Highlight(word string, forms ...string) func(args ...string) (template.HTML, error) {
+	var re *regexp.Regexp
+	if word = strings.TrimSpace(word); word != "" {
+		re = formsRegexp(append(inflect.Forms(word), forms...))
+	}
+
+	return func(args ...string) (template.HTML, error) {
+		class := "highlight"
+		switch len(args) {
+		case 1:
+		case 2:
+			class = args[0]
+		default:
+			return "", fmt.Errorf("highlight_word: expected 1 or 2 arguments, got %d", len(args))
 		}
-		return template.HTML(sentence)
+
+		sentence := args[len(args)-1]
+		if sentence != "" && re != nil {
+			repl := fmt.Sprintf(`<span class="%s">$1</span>`, template.HTMLEscapeString(class))
+			sentence = re.ReplaceAllString(sentence, repl)
+		}
+		return template.HTML(sentence), nil
 	}
 }
 
+// formsRegexp compiles a regexp matching any of forms as whole words,
+// preferring longer forms.
+func formsRegexp(forms []string) *regexp.Regexp {
+	alts := make([]string, 0, len(forms))
+	for _, form := range forms {
+		words := strings.Fields(form)
+		if len(words) == 0 {
+			continue
+		}
+		for i, w := range words {
+			words[i] = regexp.QuoteMeta(w)
+		}
+		alts = append(alts, strings.Join(words, `\s+`))
+	}
+	if len(alts) == 0 {
+		return nil
+	}
+
+	alts = utils.SliceUnique(alts)
+	slices.SortStableFunc(alts, func(a, b string) int {
+		return len(b) - len(a)
+	})
+
+	re, err := regexp.Compile(fmt.Sprintf(`(?i)\b(%s)\b`, strings.Join(alts, "|")))
+	if err != nil {
+		return nil
+	}
+	return re
+}
+
+// Builtins returns the functions available to all templates. Its "len"
+// replaces the builtin len of text/template, returning 0 for nil values,
+// such as missing JSON fields, instead of failing.
 func Builtins() template.FuncMap {
 	return template.FuncMap{
 		"join":  Join,
 		"limit": Limit,
+
+		// Lists and objects
+		"first":  First,
+		"last":   Last,
+		"uniq":   Uniq,
+		"sortBy": SortBy,
+		"filter": Filter,
+		"pluck":  Pluck,
+		"len":    Len, // Replaces the builtin len.
+		"dict":   Dict,
+		"list":   List,
+
+		// Conditionals
+		"default":  Default,
+		"coalesce": Coalesce,
+
+		// Strings
+		"split":        Split,
+		"replace":      Replace,
+		"regexReplace": RegexReplace,
+		"truncate":     Truncate,
+		"title":        Title,
+		"lower":        Lower,
+		"upper":        Upper,
+		"toJSON":       ToJSON,
+		"safeHTML":     SafeHTML,
 	}
 }
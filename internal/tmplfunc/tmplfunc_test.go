@@ -0,0 +1,121 @@
+package tmplfunc
+
+import (
+	"bytes"
+	"html/template"
+	"testing"
+)
+
+func TestJoin(t *testing.T) {
+	tests := []struct {
+		name    string
+		elems   any
+		want    string
+		wantErr bool
+	}{
+		{"nil", nil, "", false},
+		{"empty", []any{}, "", false},
+		{"strings", []string{"a", "b"}, "a, b", false},
+		{"mixed", []any{"n.", 1.0, 2.5, true, nil, map[string]any{"a": "b"}}, "n., 1, 2.5, true, map[a:b]", false},
+		{"string", "a", "", true},
+		{"object", map[string]any{"a": "b"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Join(", ", tt.elems)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Join() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Join() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name  string
+		word  string
+		forms []string
+		args  []string
+		want  template.HTML
+	}{
+		{
+			name: "word",
+			word: "apple",
+			args: []string{"An apple a day."},
+			want: `An <span class="highlight">apple</span> a day.`,
+		},
+		{
+			name: "case and inflection",
+			word: "apple",
+			args: []string{"Apples and pineapples."},
+			want: `<span class="highlight">Apples</span> and pineapples.`,
+		},
+		{
+			name: "irregular",
+			word: "run",
+			args: []string{"She ran home."},
+			want: `She <span class="highlight">ran</span> home.`,
+		},
+		{
+			name:  "dictionary forms",
+			word:  "be",
+			forms: []string{"was"},
+			args:  []string{"It was late."},
+			want:  `It <span class="highlight">was</span> late.`,
+		},
+		{
+			name: "phrase",
+			word: "give up",
+			args: []string{"He gave\n up smoking."},
+			want: "He <span class=\"highlight\">gave\n up</span> smoking.",
+		},
+		{
+			name: "class",
+			word: "apple",
+			args: []string{"mark", "apple"},
+			want: `<span class="mark">apple</span>`,
+		},
+		{
+			name: "empty word",
+			word: " ",
+			args: []string{"An apple."},
+			want: "An apple.",
+		},
+		{
+			name: "empty sentence",
+			word: "apple",
+			args: []string{""},
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Highlight(tt.word, tt.forms...)(tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("highlight_word = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Highlight("apple")(); err == nil {
+		t.Error("highlight_word with no arguments succeeded")
+	}
+}
+
+// TestBuiltinsLen checks that len replaces the builtin, which fails on nil.
+func TestBuiltinsLen(t *testing.T) {
+	tmpl := template.Must(template.New("").Funcs(Builtins()).Parse(`{{len .missing}} {{len .list}}`))
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, map[string]any{"list": []any{1.0, nil}}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "0 2"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -39,6 +39,51 @@ func InspectTree(t *parse.Tree) (fields []string, funcs []string, err error) {
 	return fields, funcs, nil
 }
 
+// InspectUnconditional is like InspectTree, but only reports the fields and
+// functions evaluated on every execution of the template, that is, those
+// outside the branches of if, range and with actions.
+func InspectUnconditional(t *parse.Tree) (fields []string, funcs []string, err error) {
+	fieldMap := make(map[string]struct{})
+	funcMap := make(map[string]struct{})
+
+	walkUnconditional(t.Root, fieldMap, funcMap)
+
+	fields = slices.Sorted(maps.Keys(fieldMap))
+	funcs = slices.Sorted(maps.Keys(funcMap))
+
+	return fields, funcs, nil
+}
+
+// walkUnconditional walks the top-level actions of a list and the pipes of
+// its branch nodes, without descending into the branches themselves.
+func walkUnconditional(node parse.Node, fieldMap, funcMap map[string]struct{}) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n != nil {
+			for _, subNode := range n.Nodes {
+				walkUnconditional(subNode, fieldMap, funcMap)
+			}
+		}
+
+	case *parse.ActionNode:
+		walk(n.Pipe, fieldMap, funcMap, nil)
+
+	case *parse.IfNode:
+		walk(n.Pipe, fieldMap, funcMap, nil)
+
+	case *parse.RangeNode:
+		walk(n.Pipe, fieldMap, funcMap, nil)
+
+	case *parse.WithNode:
+		walk(n.Pipe, fieldMap, funcMap, nil)
+
+	case *parse.TemplateNode:
+		if n.Pipe != nil {
+			walk(n.Pipe, fieldMap, funcMap, nil)
+		}
+	}
+}
+
 // walk recursively traverses the template's AST, populating the field and function maps.
 // It carries a prefix to handle nested contexts like in `range` and `with` blocks.
 func walk(node parse.Node, fieldMap, funcMap map[string]struct{}, prefix []string) {
@@ -70,6 +115,20 @@ func walk(node parse.Node, fieldMap, funcMap map[string]struct{}, prefix []strin
 			fieldMap[field] = struct{}{}
 		}
 
+	case *parse.VariableNode:
+		// $.a.b always refers to the root of the data.
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			fieldMap[strings.Join(n.Ident[1:], ".")] = struct{}{}
+		}
+
+	case *parse.ChainNode:
+		walk(n.Node, fieldMap, funcMap, prefix)
+
+	case *parse.TemplateNode:
+		if n.Pipe != nil {
+			walk(n.Pipe, fieldMap, funcMap, prefix)
+		}
+
 	case *parse.PipeNode:
 		for _, cmd := range n.Cmds {
 			walk(cmd, fieldMap, funcMap, prefix)
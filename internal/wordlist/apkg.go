@@ -0,0 +1,141 @@
+package wordlist
+
+import (
+	"fmt"
+	"html"
+	"iter"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/lftk/anki"
+)
+
+// isPackage reports whether path refers to an Anki package (.apkg or .colpkg).
+func isPackage(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".apkg", ".colpkg":
+		return true
+	}
+	return false
+}
+
+// loadPackage loads the notes of the Anki package at path as words, taking
+// the text of the named field (or the first field if field is empty) as the
+// word. Notes keep their tags and are grouped by the deck of their first card.
+func loadPackage(path, field string) iter.Seq2[*Deck, error] {
+	return func(yield func(*Deck, error) bool) {
+		decks, err := readPackage(path, field)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for _, deck := range decks {
+			if !yield(deck, nil) {
+				return
+			}
+		}
+	}
+}
+
+func readPackage(path, field string) ([]*Deck, error) {
+	col, err := anki.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer col.Close()
+
+	noteDecks := make(map[int64]int64)
+	for card, err := range col.ListCards(nil) {
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := noteDecks[card.NoteID]; !ok || card.Ordinal == 0 {
+			noteDecks[card.NoteID] = card.DeckID
+		}
+	}
+
+	fieldOrds := make(map[int64]int)
+	var (
+		decks  []*Deck
+		byDeck = make(map[int64]*Deck)
+	)
+	for note, err := range col.ListNotes(nil) {
+		if err != nil {
+			return nil, err
+		}
+
+		ord, ok := fieldOrds[note.NotetypeID]
+		if !ok {
+			ord, err = fieldOrdinal(col, note.NotetypeID, field)
+			if err != nil {
+				return nil, err
+			}
+			fieldOrds[note.NotetypeID] = ord
+		}
+		if ord < 0 || ord >= len(note.Fields) {
+			continue
+		}
+
+		text := plainText(note.Fields[ord])
+		if text == "" {
+			continue
+		}
+
+		did := noteDecks[note.ID]
+		deck, ok := byDeck[did]
+		if !ok {
+			d, err := col.GetDeck(did)
+			if err != nil {
+				return nil, err
+			}
+			deck = &Deck{Path: d.Name.Components()}
+			byDeck[did] = deck
+			decks = append(decks, deck)
+		}
+
+		deck.Words = append(deck.Words, &Word{
+			Text: text,
+			Tags: slices.Clone(note.Tags),
+		})
+	}
+
+	if len(decks) == 0 && field != "" {
+		return nil, fmt.Errorf("no notes with field %q in %q", field, path)
+	}
+	return decks, nil
+}
+
+// fieldOrdinal returns the ordinal of the named field of a notetype, or -1
+// if the notetype has no such field, so its notes are skipped.
+func fieldOrdinal(col *anki.Collection, ntid int64, field string) (int, error) {
+	if field == "" {
+		return 0, nil
+	}
+
+	nt, err := col.GetNotetype(ntid)
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range nt.Fields {
+		if strings.EqualFold(f.Name, field) {
+			return f.Ordinal, nil
+		}
+	}
+
+	return -1, nil
+}
+
+var (
+	reSound = regexp.MustCompile(`\[sound:[^\]]*\]`)
+	reTag   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// plainText strips HTML tags and sound references from an Anki field.
+func plainText(s string) string {
+	s = reSound.ReplaceAllString(s, "")
+	s = reTag.ReplaceAllString(s, " ")
+	s = html.UnescapeString(s)
+	return strings.Join(strings.Fields(s), " ")
+}
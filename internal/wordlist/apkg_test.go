@@ -0,0 +1,114 @@
+package wordlist
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lftk/anki"
+)
+
+// testPackage saves a package with notes of two notetypes in two decks.
+func testPackage(t *testing.T) string {
+	t.Helper()
+	col, err := anki.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer col.Close()
+
+	addNotetype := func(id int64, name string, fields ...string) int64 {
+		var fs []*anki.Field
+		for _, f := range fields {
+			fs = append(fs, anki.NewField(f))
+		}
+		nt := &anki.Notetype{
+			ID:     id,
+			Name:   name,
+			Fields: fs,
+			Templates: []*anki.Template{
+				anki.NewTemplate("Card 1", "{{"+fields[0]+"}}", "{{"+fields[1]+"}}"),
+			},
+			Config: anki.NewNotetypeConfig("", false),
+		}
+		if err := col.AddNotetype(nt); err != nil {
+			t.Fatal(err)
+		}
+		return nt.ID
+	}
+	addDeck := func(name ...string) int64 {
+		d := &anki.Deck{Name: anki.JoinDeckName(name...)}
+		if err := col.AddDeck(d); err != nil {
+			t.Fatal(err)
+		}
+		return d.ID
+	}
+	addNote := func(did, ntid int64, tags []string, fields ...string) {
+		n := &anki.Note{NotetypeID: ntid, Fields: fields, Tags: tags}
+		if err := col.AddNote(did, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	basic := addNotetype(1, "Basic", "Front", "Back")
+	vocab := addNotetype(2, "Vocab", "Word", "Front")
+	a := addDeck("Root", "A")
+	b := addDeck("Root", "B")
+
+	addNote(a, basic, []string{"verb", "common"}, "<b>run</b> [sound:run.mp3]", "correr")
+	addNote(b, basic, nil, "caf&eacute;<br>", "<div>coffee</div>")
+	addNote(b, vocab, []string{"verb"}, "walk", "andar")
+	addNote(a, basic, nil, "[sound:silence.mp3] <br/>", "")
+
+	path := filepath.Join(t.TempDir(), "test.apkg")
+	if err := col.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadPackage(t *testing.T) {
+	path := testPackage(t)
+	tests := []struct {
+		field string
+		decks string
+	}{
+		{"", "Root::A: run[verb common]; Root::B: café, walk[verb]"},
+		{"Back", "Root::A: correr[verb common]; Root::B: coffee"},
+		{"front", "Root::A: run[verb common]; Root::B: café, andar[verb]"},
+		{"word", "Root::B: walk[verb]"},
+	}
+	for _, tt := range tests {
+		decks, err := readPackage(path, tt.field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := formatDecks(decks); got != tt.decks {
+			t.Errorf("readPackage(%q) = %q, want %q", tt.field, got, tt.decks)
+		}
+	}
+
+	_, err := readPackage(path, "missing")
+	if err == nil || !strings.Contains(err.Error(), `no notes with field "missing"`) {
+		t.Errorf("readPackage(missing) err = %v", err)
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"run", "run"},
+		{"<b>give</b>&nbsp;up", "give up"},
+		{"<div>look</div><div>after</div>", "look after"},
+		{"run[sound:run.mp3]", "run"},
+		{"[sound:a.mp3] [sound:b.mp3]", ""},
+		{"fish &amp; chips", "fish & chips"},
+		{"[pos=verb]", "[pos=verb]"},
+	}
+	for _, tt := range tests {
+		if got := plainText(tt.in); got != tt.want {
+			t.Errorf("plainText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package wordlist
+
+import (
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/lftk/anki-vocab/internal/utils"
+)
+
+// CaseMode controls how letter case is treated during normalization.
+type CaseMode string
+
+const (
+	CasePreserve CaseMode = "preserve" // Keep the case, compare words exactly.
+	CaseLower    CaseMode = "lower"    // Convert words to lower case.
+	CaseFold     CaseMode = "fold"     // Keep the case, compare words case-insensitively.
+)
+
+// DuplicateMode controls what happens to a word that appears more than once.
+type DuplicateMode string
+
+const (
+	DuplicateFirst DuplicateMode = "first" // Keep the first occurrence only.
+	DuplicateMerge DuplicateMode = "merge" // Keep the first occurrence, merging the tags of the others into it.
+	DuplicateDecks DuplicateMode = "decks" // Allow a word once per deck.
+)
+
+type Options struct {
+	Case       CaseMode
+	Duplicates DuplicateMode
+
+	// Field is the note field used as the word when loading Anki packages.
+	// The first field is used if empty.
+	Field string
+}
+
+// Duplicate records a word whose extra occurrences were removed.
+type Duplicate struct {
+	Word  string
+	Count int // Number of occurrences removed.
+}
+
+// Normalize trims and normalizes (Unicode NFC) every word, then removes
+// duplicates according to opts. Decks left without words are dropped.
+func Normalize(decks iter.Seq2[*Deck, error], opts *Options) ([]*Deck, []*Duplicate, error) {
+	type entry struct {
+		word *Word
+		dup  *Duplicate
+	}
+
+	var (
+		result  []*Deck
+		dups    []*Duplicate
+		entries = make(map[string]*entry)
+	)
+	for deck, err := range decks {
+		if err != nil {
+			return nil, nil, err
+		}
+
+		words := make([]*Word, 0, len(deck.Words))
+		for _, word := range deck.Words {
+			text := normalizeText(word.Text, opts)
+			if text == "" {
+				continue
+			}
+
+			key := text
+			if opts.Case == CaseFold {
+				key = strings.ToLower(key)
+			}
+			if len(word.Hints) > 0 {
+				// The same word with different hints may refer to different senses.
+				key += fmt.Sprint(word.Hints)
+			}
+			if opts.Duplicates == DuplicateDecks {
+				key = strings.Join(deck.Path, "::") + "::" + key
+			}
+
+			e, ok := entries[key]
+			if !ok {
+				w := &Word{Text: text, Tags: word.Tags, Hints: word.Hints}
+				entries[key] = &entry{word: w}
+				words = append(words, w)
+				continue
+			}
+
+			if e.dup == nil {
+				e.dup = &Duplicate{Word: e.word.Text}
+				dups = append(dups, e.dup)
+			}
+			e.dup.Count++
+
+			if opts.Duplicates == DuplicateMerge {
+				e.word.Tags = utils.SliceUnique(append(e.word.Tags, word.Tags...))
+			}
+		}
+
+		if len(words) > 0 {
+			result = append(result, &Deck{Path: deck.Path, Words: words})
+		}
+	}
+	return result, dups, nil
+}
+
+func normalizeText(text string, opts *Options) string {
+	text = strings.Join(strings.Fields(text), " ")
+	text = norm.NFC.String(text)
+	if opts.Case == CaseLower {
+		text = strings.ToLower(text)
+	}
+	return text
+}
+
+// ParseCaseMode parses s as a CaseMode.
+func ParseCaseMode(s string) (CaseMode, error) {
+	m := CaseMode(s)
+	if !slices.Contains([]CaseMode{CasePreserve, CaseLower, CaseFold}, m) {
+		return "", fmt.Errorf("unknown case mode: %q", s)
+	}
+	return m, nil
+}
+
+// ParseDuplicateMode parses s as a DuplicateMode.
+func ParseDuplicateMode(s string) (DuplicateMode, error) {
+	m := DuplicateMode(s)
+	if !slices.Contains([]DuplicateMode{DuplicateFirst, DuplicateMerge, DuplicateDecks}, m) {
+		return "", fmt.Errorf("unknown duplicate mode: %q", s)
+	}
+	return m, nil
+}
@@ -0,0 +1,125 @@
+package wordlist
+
+import (
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func testDecks() iter.Seq2[*Deck, error] {
+	decks := []*Deck{
+		{Path: []string{"a"}, Words: []*Word{
+			{Text: "apple", Tags: []string{"fruit"}},
+			{Text: "Apple", Tags: []string{"company"}},
+			{Text: "  give \t up "},
+			{Text: "bank", Hints: map[string]string{"pos": "n"}},
+			{Text: "bank", Hints: map[string]string{"pos": "v"}},
+			{Text: "café"},
+		}},
+		{Path: []string{"b"}, Words: []*Word{
+			{Text: "apple", Tags: []string{"red"}},
+			{Text: "bank", Hints: map[string]string{"pos": "n"}},
+			{Text: "café"},
+		}},
+		{Path: []string{"c"}, Words: []*Word{{Text: " "}}},
+	}
+	return func(yield func(*Deck, error) bool) {
+		for _, d := range decks {
+			if !yield(d, nil) {
+				return
+			}
+		}
+	}
+}
+
+// formatDecks formats decks as "path: word[tags]{hint=value}, ...; ...".
+func formatDecks(decks []*Deck) string {
+	var ds []string
+	for _, d := range decks {
+		var ws []string
+		for _, w := range d.Words {
+			s := w.Text
+			if len(w.Tags) > 0 {
+				s += fmt.Sprint(w.Tags)
+			}
+			for _, k := range slices.Sorted(maps.Keys(w.Hints)) {
+				s += fmt.Sprintf("{%s=%s}", k, w.Hints[k])
+			}
+			ws = append(ws, s)
+		}
+		ds = append(ds, strings.Join(d.Path, "::")+": "+strings.Join(ws, ", "))
+	}
+	return strings.Join(ds, "; ")
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		opts  Options
+		decks string
+		dups  []Duplicate
+	}{
+		{
+			opts:  Options{Case: CasePreserve, Duplicates: DuplicateFirst},
+			decks: "a: apple[fruit], Apple[company], give up, bank{pos=n}, bank{pos=v}, café",
+			dups:  []Duplicate{{"apple", 1}, {"bank", 1}, {"café", 1}},
+		},
+		{
+			opts:  Options{Case: CasePreserve, Duplicates: DuplicateMerge},
+			decks: "a: apple[fruit red], Apple[company], give up, bank{pos=n}, bank{pos=v}, café",
+			dups:  []Duplicate{{"apple", 1}, {"bank", 1}, {"café", 1}},
+		},
+		{
+			opts:  Options{Case: CasePreserve, Duplicates: DuplicateDecks},
+			decks: "a: apple[fruit], Apple[company], give up, bank{pos=n}, bank{pos=v}, café; b: apple[red], bank{pos=n}, café",
+		},
+		{
+			opts:  Options{Case: CaseLower, Duplicates: DuplicateMerge},
+			decks: "a: apple[fruit company red], give up, bank{pos=n}, bank{pos=v}, café",
+			dups:  []Duplicate{{"apple", 2}, {"bank", 1}, {"café", 1}},
+		},
+		{
+			opts:  Options{Case: CaseFold, Duplicates: DuplicateFirst},
+			decks: "a: apple[fruit], give up, bank{pos=n}, bank{pos=v}, café",
+			dups:  []Duplicate{{"apple", 2}, {"bank", 1}, {"café", 1}},
+		},
+		{
+			opts:  Options{Case: CaseFold, Duplicates: DuplicateDecks},
+			decks: "a: apple[fruit], give up, bank{pos=n}, bank{pos=v}, café; b: apple[red], bank{pos=n}, café",
+			dups:  []Duplicate{{"apple", 1}},
+		},
+	}
+	for _, tt := range tests {
+		decks, dups, err := Normalize(testDecks(), &tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := formatDecks(decks); got != tt.decks {
+			t.Errorf("%+v: decks = %s, want %s", tt.opts, got, tt.decks)
+		}
+		var gotDups []Duplicate
+		for _, d := range dups {
+			gotDups = append(gotDups, *d)
+		}
+		if !slices.Equal(gotDups, tt.dups) {
+			t.Errorf("%+v: duplicates = %v, want %v", tt.opts, gotDups, tt.dups)
+		}
+	}
+}
+
+func TestParseModes(t *testing.T) {
+	if m, err := ParseCaseMode("fold"); err != nil || m != CaseFold {
+		t.Errorf("ParseCaseMode(fold) = %q, %v", m, err)
+	}
+	if _, err := ParseCaseMode("upper"); err == nil {
+		t.Error("ParseCaseMode(upper) succeeded, want an error")
+	}
+	if m, err := ParseDuplicateMode("decks"); err != nil || m != DuplicateDecks {
+		t.Errorf("ParseDuplicateMode(decks) = %q, %v", m, err)
+	}
+	if _, err := ParseDuplicateMode("all"); err == nil {
+		t.Error("ParseDuplicateMode(all) succeeded, want an error")
+	}
+}
@@ -2,23 +2,120 @@ package wordlist
 
 import (
 	"bufio"
+	"fmt"
+	"io"
 	"iter"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+
+	"github.com/lftk/anki-vocab/internal/utils"
 )
 
+// Stdin is the path that refers to the standard input.
+const Stdin = "-"
+
 type Word struct {
-	Text string
-	Tags []string
+	Text  string
+	Tags  []string
+	Hints map[string]string // Inline directives such as "[pos=verb]".
 }
 
 type Deck struct {
-	Name  string
+	Path  []string // Deck name components, relative to the root deck.
 	Words []*Word
 }
 
-func Load(path string) iter.Seq2[*Deck, error] {
+// Glob expands the given patterns into a list of wordlist paths.
+// A pattern may be a file path, a glob pattern, a directory (all of its
+// ".txt" files are used) or Stdin.
+func Glob(patterns ...string) ([]string, error) {
+	var paths []string
+	for _, pattern := range patterns {
+		if pattern == Stdin {
+			paths = append(paths, pattern)
+			continue
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no wordlist matches %q", pattern)
+		}
+
+		for _, match := range matches {
+			fi, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !fi.IsDir() {
+				paths = append(paths, match)
+				continue
+			}
+
+			files, err := filepath.Glob(filepath.Join(match, "*.txt"))
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, files...)
+		}
+	}
+	return utils.SliceUnique(paths), nil
+}
+
+// Name returns the default deck name of the wordlist at path,
+// which is the file name without its extension.
+func Name(path string) string {
+	if path == Stdin {
+		return "stdin"
+	}
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// LoadAll loads the wordlists at paths one after another. When more than
+// one path is given, each wordlist becomes a deck named after its file,
+// unless its headings say otherwise.
+//
+// Headings ("## name", "### name", ...) start nested sub-decks, and the
+// words below a heading inherit its tags. Anki packages (.apkg, .colpkg)
+// keep their own deck structure and tags, see opts.Field.
+func LoadAll(paths []string, opts *Options) iter.Seq2[*Deck, error] {
 	return func(yield func(*Deck, error) bool) {
+		for _, path := range paths {
+			var name string
+			if len(paths) > 1 {
+				name = Name(path)
+			}
+
+			decks := load(path, name)
+			if isPackage(path) {
+				decks = loadPackage(path, opts.Field)
+			}
+			for deck, err := range decks {
+				if !yield(deck, err) || err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+func load(path, name string) iter.Seq2[*Deck, error] {
+	return func(yield func(*Deck, error) bool) {
+		if path == Stdin {
+			for deck, err := range read(os.Stdin, name) {
+				if !yield(deck, err) {
+					return
+				}
+			}
+			return
+		}
+
 		f, err := os.Open(path)
 		if err != nil {
 			yield(nil, err)
@@ -26,8 +123,26 @@ func Load(path string) iter.Seq2[*Deck, error] {
 		}
 		defer f.Close()
 
-		deck := new(Deck)
-		scanner := bufio.NewScanner(f)
+		for deck, err := range read(f, name) {
+			if !yield(deck, err) {
+				return
+			}
+		}
+	}
+}
+
+func read(r io.Reader, name string) iter.Seq2[*Deck, error] {
+	return func(yield func(*Deck, error) bool) {
+		var (
+			root     []string
+			headings []*heading
+		)
+		if name != "" {
+			root = []string{name}
+		}
+
+		deck := &Deck{Path: root}
+		scanner := bufio.NewScanner(r)
 		for scanner.Scan() {
 			line := scanner.Text()
 			line = strings.TrimSpace(line)
@@ -36,43 +151,139 @@ func Load(path string) iter.Seq2[*Deck, error] {
 				continue
 			}
 
-			if deckName, ok := strings.CutPrefix(line, "## "); ok {
-				if deckName != deck.Name {
-					if !yield(deck, nil) {
+			if level, h, ok := parseHeading(line); ok {
+				headings = append(headings[:min(level, len(headings))], h)
+
+				path := headingPath(headings)
+				if !slices.Equal(path, deck.Path) {
+					if len(deck.Words) > 0 && !yield(deck, nil) {
 						return
 					}
-					deck = &Deck{Name: deckName}
+					deck = &Deck{Path: path}
 				}
 				continue
 			}
 
-			var tags []string
-			word, after, ok := strings.Cut(line, "#")
-			if ok {
-				for tag := range strings.SplitSeq(after, "#") {
-					tag = strings.TrimSpace(tag)
-					if tag != "" {
-						tags = append(tags, tag)
-					}
-				}
-			}
-
-			word = strings.TrimSpace(word)
+			word, tags := parseTags(line)
+			word, hints := parseHints(word)
 			if word != "" {
 				deck.Words = append(deck.Words, &Word{
-					Text: word,
-					Tags: tags,
+					Text:  word,
+					Tags:  utils.SliceUnique(append(headingTags(headings), tags...)),
+					Hints: hints,
 				})
 			}
 		}
 
-		if !yield(deck, nil) {
+		if len(deck.Words) > 0 && !yield(deck, nil) {
 			return
 		}
 
-		if err = scanner.Err(); err != nil {
+		if err := scanner.Err(); err != nil {
 			yield(nil, err)
 			return
 		}
 	}
 }
+
+type heading struct {
+	names []string
+	tags  []string
+}
+
+// parseHeading parses a heading line such as "## name # tag". The returned
+// level is zero-based: "##" is level 0, "###" is level 1, and so on.
+// A name may also spell out several levels at once, as in "## a::b::c".
+func parseHeading(line string) (int, *heading, bool) {
+	n := len(line) - len(strings.TrimLeft(line, "#"))
+	if n < 2 || !strings.HasPrefix(line[n:], " ") {
+		return 0, nil, false
+	}
+
+	text, tags := parseTags(line[n:])
+
+	var names []string
+	for name := range strings.SplitSeq(text, "::") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return 0, nil, false
+	}
+
+	return n - 2, &heading{names: names, tags: tags}, true
+}
+
+func headingPath(headings []*heading) []string {
+	var path []string
+	for _, h := range headings {
+		path = append(path, h.names...)
+	}
+	return path
+}
+
+func headingTags(headings []*heading) []string {
+	var tags []string
+	for _, h := range headings {
+		tags = append(tags, h.tags...)
+	}
+	return tags
+}
+
+func parseTags(line string) (string, []string) {
+	var tags []string
+	text, after, ok := strings.Cut(line, "#")
+	if ok {
+		for tag := range strings.SplitSeq(after, "#") {
+			tag = strings.TrimSpace(tag)
+			if tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return strings.TrimSpace(text), tags
+}
+
+// parseHints extracts inline directives such as `[pos=verb] [sense="to guide"]`
+// from text. Brackets that are not of the form [key=value] are kept as is.
+func parseHints(text string) (string, map[string]string) {
+	var (
+		b     strings.Builder
+		hints map[string]string
+	)
+	for {
+		i := strings.IndexByte(text, '[')
+		if i < 0 {
+			break
+		}
+		j := strings.IndexByte(text[i:], ']')
+		if j < 0 {
+			break
+		}
+		j += i
+
+		key, val, ok := strings.Cut(text[i+1:j], "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			b.WriteString(text[:j+1])
+			text = text[j+1:]
+			continue
+		}
+
+		val = strings.TrimSpace(val)
+		if s, err := strconv.Unquote(val); err == nil {
+			val = s
+		}
+		if hints == nil {
+			hints = make(map[string]string)
+		}
+		hints[key] = val
+
+		b.WriteString(text[:i])
+		text = text[j+1:]
+	}
+	b.WriteString(text)
+	return strings.Join(strings.Fields(b.String()), " "), hints
+}
@@ -0,0 +1,182 @@
+package wordlist
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseHeading(t *testing.T) {
+	tests := []struct {
+		line  string
+		level int
+		names []string
+		tags  []string
+		ok    bool
+	}{
+		{"## verbs", 0, []string{"verbs"}, nil, true},
+		{"### irregular # hard #verb", 1, []string{"irregular"}, []string{"hard", "verb"}, true},
+		{"#### a :: b::c", 2, []string{"a", "b", "c"}, nil, true},
+		{"## a:: ::b", 0, []string{"a", "b"}, nil, true},
+		{"# title", 0, nil, nil, false},
+		{"##verbs", 0, nil, nil, false},
+		{"## ", 0, nil, nil, false},
+		{"## :: # tag", 0, nil, nil, false},
+		{"run # verb", 0, nil, nil, false},
+	}
+	for _, tt := range tests {
+		level, h, ok := parseHeading(tt.line)
+		if ok != tt.ok {
+			t.Errorf("parseHeading(%q) ok = %v, want %v", tt.line, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if level != tt.level || !slices.Equal(h.names, tt.names) || !slices.Equal(h.tags, tt.tags) {
+			t.Errorf("parseHeading(%q) = %d, %q, %q; want %d, %q, %q",
+				tt.line, level, h.names, h.tags, tt.level, tt.names, tt.tags)
+		}
+	}
+}
+
+func TestHeadingPathAndTags(t *testing.T) {
+	var headings []*heading
+	for _, line := range []string{"## a::b # x", "### c # y", "#### d # x # z"} {
+		level, h, ok := parseHeading(line)
+		if !ok {
+			t.Fatalf("parseHeading(%q) failed", line)
+		}
+		headings = append(headings[:min(level, len(headings))], h)
+	}
+	if got, want := headingPath(headings), []string{"a", "b", "c", "d"}; !slices.Equal(got, want) {
+		t.Errorf("headingPath = %q, want %q", got, want)
+	}
+	if got, want := headingTags(headings), []string{"x", "y", "x", "z"}; !slices.Equal(got, want) {
+		t.Errorf("headingTags = %q, want %q", got, want)
+	}
+	if headingPath(nil) != nil || headingTags(nil) != nil {
+		t.Errorf("headingPath(nil) and headingTags(nil) should be nil")
+	}
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		decks string
+	}{
+		{
+			text:  "run\n\n// comment\n  walk  # verb #common\n",
+			decks: ": run, walk[verb common]",
+		},
+		{
+			name:  "list",
+			text:  "top\n## verbs # v\nrun # x\n### irregular # hard\ngo\n## nouns\ncat\n",
+			decks: "list: top; verbs: run[v x]; verbs::irregular: go[v hard]; nouns: cat",
+		},
+		{
+			text:  "## a::b # x\n#### deep\nrun\n### c\nwalk # x\n## a::b\ngo\n",
+			decks: "a::b::deep: run[x]; a::b::c: walk[x]; a::b: go",
+		},
+		{
+			text:  "## empty\n## a\n### b\n## a\nrun\n",
+			decks: "a: run",
+		},
+		{
+			text:  `lead [pos=verb] [sense="to guide"] # v`,
+			decks: ": lead[v]{pos=verb}{sense=to guide}",
+		},
+	}
+	for _, tt := range tests {
+		var decks []*Deck
+		for deck, err := range read(strings.NewReader(tt.text), tt.name) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			decks = append(decks, deck)
+		}
+		if got := formatDecks(decks); got != tt.decks {
+			t.Errorf("read(%q) = %q, want %q", tt.text, got, tt.decks)
+		}
+	}
+}
+
+func TestParseHints(t *testing.T) {
+	tests := []struct {
+		text  string
+		word  string
+		hints map[string]string
+	}{
+		{"run", "run", nil},
+		{"lead [pos=verb]", "lead", map[string]string{"pos": "verb"}},
+		{"lead [ pos = verb ] [sense=\"to guide\"]", "lead", map[string]string{"pos": "verb", "sense": "to guide"}},
+		{`bank [sense='river']`, "bank", map[string]string{"sense": "'river'"}},
+		{`bank [sense="unterminated]`, "bank", map[string]string{"sense": `"unterminated`}},
+		{"[pos=noun] bank", "bank", map[string]string{"pos": "noun"}},
+		{"give [sb] up", "give [sb] up", nil},
+		{"a [=b] c", "a [=b] c", nil},
+		{"a [b c", "a [b c", nil},
+		{"a ]b[ c", "a ]b[ c", nil},
+		{"give [sb] [pos=verb]  up", "give [sb] up", map[string]string{"pos": "verb"}},
+		{"[x=]", "", map[string]string{"x": ""}},
+	}
+	for _, tt := range tests {
+		word, hints := parseHints(tt.text)
+		if word != tt.word || !maps.Equal(hints, tt.hints) {
+			t.Errorf("parseHints(%q) = %q, %q; want %q, %q", tt.text, word, hints, tt.word, tt.hints)
+		}
+	}
+}
+
+func TestGlob(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.md", "sub/d.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	join := func(names ...string) []string {
+		var paths []string
+		for _, name := range names {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+		return paths
+	}
+
+	tests := []struct {
+		patterns []string
+		want     []string
+	}{
+		{join("a.txt"), join("a.txt")},
+		{join("*.txt"), join("a.txt", "b.txt")},
+		{join(""), join("a.txt", "b.txt")},
+		{join("*"), join("a.txt", "b.txt", "c.md", "sub/d.txt")},
+		{join("a.txt", "*.txt", "a.txt"), join("a.txt", "b.txt")},
+		{join("b.txt", "*", "sub/d.txt"), join("b.txt", "a.txt", "c.md", "sub/d.txt")},
+		{append(join("sub"), join("*.txt", "sub/*")...), join("sub/d.txt", "a.txt", "b.txt")},
+		{[]string{Stdin, join("a.txt")[0], Stdin}, []string{Stdin, join("a.txt")[0]}},
+	}
+	for _, tt := range tests {
+		got, err := Glob(tt.patterns...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Glob(%q) = %q, want %q", tt.patterns, got, tt.want)
+		}
+	}
+
+	for _, pattern := range []string{filepath.Join(dir, "missing.txt"), filepath.Join(dir, "[")} {
+		if _, err := Glob(pattern); err == nil {
+			t.Errorf("Glob(%q) succeeded", pattern)
+		}
+	}
+}